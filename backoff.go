@@ -0,0 +1,64 @@
+package remit
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes how long to wait between attempts to reconnect, both for
+// the connection as a whole and for individual endpoint channels.
+//
+// The first attempt waits for Initial, with each following attempt waiting
+// Multiplier times longer than the last, up to Max. Jitter randomly varies
+// each delay by up to that fraction of itself, so that many clients don't
+// all reconnect at the same moment.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultBackoff is used if no `ConnectionOptions.Backoff` is given, starting
+// at one second and doubling up to 30 seconds, varied by up to 20%.
+var DefaultBackoff = Backoff{
+	Initial:    time.Second,
+	Max:        30 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Duration returns how long to wait before the given attempt, starting at 0.
+func (b Backoff) Duration(attempt int) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		delay = delay + delay*b.Jitter*(rand.Float64()*2-1)
+	}
+
+	return time.Duration(delay)
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b == (Backoff{}) {
+		return DefaultBackoff
+	}
+
+	if b.Initial == 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+
+	if b.Max == 0 {
+		b.Max = DefaultBackoff.Max
+	}
+
+	if b.Multiplier == 0 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+
+	return b
+}
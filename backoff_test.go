@@ -0,0 +1,67 @@
+package remit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	backoff := Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        time.Second,
+		Multiplier: 2,
+	}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{20, time.Second},
+	}
+
+	for _, test := range tests {
+		got := backoff.Duration(test.attempt)
+		if got != test.want {
+			t.Errorf("Duration(%d) = %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	backoff := Backoff{
+		Initial:    time.Second,
+		Max:        time.Second,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+
+	for i := 0; i < 100; i++ {
+		got := backoff.Duration(0)
+		if got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("Duration(0) = %v, want within 20%% of 1s", got)
+		}
+	}
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		want    Backoff
+	}{
+		{"empty", Backoff{}, DefaultBackoff},
+		{"initial only", Backoff{Initial: 5 * time.Second}, Backoff{Initial: 5 * time.Second, Max: DefaultBackoff.Max, Multiplier: DefaultBackoff.Multiplier}},
+	}
+
+	for _, test := range tests {
+		got := test.backoff.withDefaults()
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package remit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"github.com/streadway/amqp"
+)
+
+// Compressor is used to compress message bodies larger than
+// `ConnectionOptions.CompressThreshold` before publishing, and to decompress
+// received messages with a matching `ContentEncoding`.
+//
+// `Encoding` returns the content encoding compressed messages are published
+// with, such as `"gzip"`.
+//
+// The default compressor is `GzipCompressor`. Others, such as zstd, can be
+// provided using `ConnectionOptions.Compressor`:
+//
+// 	type zstdCompressor struct{}
+//
+// 	func (zstdCompressor) Encoding() string { return "zstd" }
+//
+// 	func (zstdCompressor) Compress(body []byte) ([]byte, error) {
+// 		return encoder.EncodeAll(body, nil), nil
+// 	}
+//
+// 	func (zstdCompressor) Decompress(body []byte) ([]byte, error) {
+// 		return decoder.DecodeAll(body, nil)
+// 	}
+//
+type Compressor interface {
+	Encoding() string
+	Compress(body []byte) ([]byte, error)
+	Decompress(body []byte) ([]byte, error)
+}
+
+// GzipCompressor is the default `Compressor`, gzipping message bodies at
+// the given `Level`. Zero, the default, means `gzip.DefaultCompression`.
+type GzipCompressor struct {
+	Level int
+}
+
+// Encoding returns `"gzip"`.
+func (GzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+// Compress gzips `body`.
+func (c GzipCompressor) Compress(body []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, level)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Decompress gunzips `body`.
+func (GzipCompressor) Decompress(body []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// compress compresses the body of `message` using `compressor` if it's larger
+// than `threshold` bytes, setting its `ContentEncoding` to match. A
+// `threshold` of zero disables compression.
+func compress(message *amqp.Publishing, threshold int, compressor Compressor) error {
+	if threshold <= 0 || len(message.Body) <= threshold || message.ContentEncoding != "" {
+		return nil
+	}
+
+	body, err := compressor.Compress(message.Body)
+	if err != nil {
+		return err
+	}
+
+	message.Body = body
+	message.ContentEncoding = compressor.Encoding()
+
+	return nil
+}
+
+// decompress returns `body`, decompressing it first with the compressor for
+// `encoding`, if there is one.
+func decompress(body []byte, encoding string, compressors map[string]Compressor) ([]byte, error) {
+	compressor, ok := compressors[encoding]
+	if !ok {
+		return body, nil
+	}
+
+	return compressor.Decompress(body)
+}
@@ -0,0 +1,84 @@
+package remit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestGzipCompressor(t *testing.T) {
+	tests := []struct {
+		level int
+		body  []byte
+	}{
+		{0, []byte("hello")},
+		{gzip.BestSpeed, bytes.Repeat([]byte("hello "), 1000)},
+		{gzip.BestCompression, bytes.Repeat([]byte("hello "), 1000)},
+		{0, []byte{}},
+	}
+
+	for _, test := range tests {
+		compressor := GzipCompressor{Level: test.level}
+
+		compressed, err := compressor.Compress(test.body)
+		if err != nil {
+			t.Fatalf("level %d: %v", test.level, err)
+		}
+
+		body, err := compressor.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("level %d: %v", test.level, err)
+		}
+		if !bytes.Equal(body, test.body) {
+			t.Errorf("level %d: got %q back", test.level, body)
+		}
+	}
+
+	_, err := GzipCompressor{}.Decompress([]byte("not gzipped"))
+	if err == nil {
+		t.Error("decompressed an invalid body without an error")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 100)
+
+	tests := []struct {
+		name      string
+		message   amqp.Publishing
+		threshold int
+		want      bool
+	}{
+		{"over threshold", amqp.Publishing{Body: large}, 10, true},
+		{"under threshold", amqp.Publishing{Body: large}, 1000, false},
+		{"at threshold", amqp.Publishing{Body: large}, 100, false},
+		{"disabled", amqp.Publishing{Body: large}, 0, false},
+		{"already encoded", amqp.Publishing{Body: large, ContentEncoding: "br"}, 10, false},
+	}
+
+	compressors := map[string]Compressor{"gzip": GzipCompressor{}}
+
+	for _, test := range tests {
+		message := test.message
+
+		err := compress(&message, test.threshold, GzipCompressor{})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		compressed := message.ContentEncoding == "gzip"
+		if compressed != test.want {
+			t.Errorf("%s: compressed = %v, want %v", test.name, compressed, test.want)
+		}
+
+		body, err := decompress(message.Body, message.ContentEncoding, compressors)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !bytes.Equal(body, large) {
+			t.Errorf("%s: didn't get the original body back", test.name)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package remit
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// brokerConnection holds the current AMQP connection and the channel used to
+// publish requests, both of which are swapped out whenever the session
+// reconnects.
+type brokerConnection struct {
+	mu             *sync.RWMutex
+	conn           Connection
+	requestChannel Channel
+
+	// the index in `Config.Urls` of the broker to try connecting to first
+	next int
+}
+
+func newBrokerConnection() *brokerConnection {
+	return &brokerConnection{
+		mu: &sync.RWMutex{},
+	}
+}
+
+func (c *brokerConnection) get() Connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.conn
+}
+
+func (c *brokerConnection) requests() Channel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.requestChannel
+}
+
+func (c *brokerConnection) set(conn Connection, requestChannel Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = conn
+	c.requestChannel = requestChannel
+}
+
+func (c *brokerConnection) first(count int) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.next % count
+}
+
+func (c *brokerConnection) connectedTo(index int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.next = index
+}
+
+// failover moves on to the broker after the one last connected to, so that
+// it's the first tried when reconnecting.
+func (c *brokerConnection) failover() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.next++
+}
+
+// dial connects to the broker, declaring the exchange and setting up the
+// channels the session needs for publishing and receiving replies.
+//
+// If several `Config.Urls` are given, each is tried in turn until one
+// succeeds, and the error from the last is returned if none do.
+//
+// Once connected, the connection is watched so that it can be re-established
+// if lost.
+func (session *Session) dial() error {
+	urls := session.Config.Urls
+	if len(urls) == 0 {
+		urls = []string{session.Config.Url}
+	}
+
+	first := session.connection.first(len(urls))
+
+	var err error
+	for i := range urls {
+		index := (first + i) % len(urls)
+
+		err = session.dialUrl(urls[index])
+		if err == nil {
+			session.connection.connectedTo(index)
+			return nil
+		}
+
+		if len(urls) > 1 {
+			session.Config.Logger.Warn("Failed to connect to broker", "host", brokerHost(urls[index]), "error", err)
+		}
+	}
+
+	return err
+}
+
+func (session *Session) dialUrl(uri string) error {
+	conn, err := session.Config.Transport.Dial(uri, amqp.Config{
+		TLSClientConfig: session.Config.TLSConfig,
+		Heartbeat:       session.Config.Heartbeat,
+		Vhost:           session.Config.Vhost,
+		Locale:          "en_US",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = session.setup(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	go session.watchConnection(conn.NotifyClose(make(chan *amqp.Error, 1)))
+
+	return nil
+}
+
+// brokerHost returns the host of an AMQP URI so it can be logged without
+// giving away any credentials it contains.
+func brokerHost(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "(invalid url)"
+	}
+
+	return u.Host
+}
+
+func (session *Session) setup(conn Connection) error {
+	if !session.Config.SkipExchangeDeclare {
+		setupChannel, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("failed to open work channel: %s", err)
+		}
+
+		err = session.declareExchange(setupChannel, session.Config.Exchange, session.Config.ExchangeType, nil)
+		if err != nil {
+			return fmt.Errorf("failed to declare %q exchange: %s", session.Config.Exchange, err)
+		}
+		setupChannel.Close()
+	}
+
+	err := session.publishers.open(conn)
+	if err != nil {
+		return fmt.Errorf("failed to open publish channel: %s", err)
+	}
+
+	requestChannel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open replies channel: %s", err)
+	}
+
+	replies, err := requestChannel.Consume(
+		"amq.rabbitmq.reply-to", // name of the queue
+		"",                      // consumer tag
+		true,                    // noAck
+		true,                    // exclusive
+		false,                   // noLocal
+		false,                   // noWait
+		nil,                     // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to consume replies: %s", err)
+	}
+
+	err = session.workerPool.reset(conn)
+	if err != nil {
+		return fmt.Errorf("failed to open work channels: %s", err)
+	}
+
+	if session.Config.Mandatory {
+		go watchForReturns(requestChannel.NotifyReturn(make(chan amqp.Return, 10)), session.handleReturn)
+	}
+
+	session.connection.set(conn, requestChannel)
+
+	go session.watchForReplies(replies)
+
+	return nil
+}
+
+// watchConnection waits for the connection to close. If it was lost rather
+// than closed via `Session.Close`, the session redials and then restores
+// every open endpoint on the new connection.
+func (session *Session) watchConnection(closing chan *amqp.Error) {
+	err, ok := <-closing
+	if !ok || err == nil {
+		return
+	}
+
+	session.Config.Logger.Warn("Connection closed; reconnecting", "reason", err.Reason)
+	if session.Config.OnDisconnect != nil {
+		session.Config.OnDisconnect(err)
+	}
+
+	session.connection.failover()
+
+	attempts := 0
+	for {
+		time.Sleep(session.Config.Backoff.Duration(attempts))
+		attempts++
+
+		err := session.dial()
+		if err == nil {
+			break
+		}
+
+		session.reportError("Failed to reconnect to RabbitMQ", err, "attempt", attempts)
+	}
+
+	session.Config.Logger.Info("Reconnected to RabbitMQ", "attempts", attempts)
+	session.Config.Metrics.ReconnectOccurred()
+	if session.Config.OnReconnect != nil {
+		session.Config.OnReconnect(attempts)
+	}
+
+	session.mu.Lock()
+	// exchanges may have been auto-deleted along with the connection
+	for name := range session.exchanges {
+		delete(session.exchanges, name)
+	}
+
+	endpoints := make([]*Endpoint, 0, len(session.endpoints))
+	for _, endpoint := range session.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	session.mu.Unlock()
+
+	for _, endpoint := range endpoints {
+		endpoint.mu.Lock()
+		old := endpoint.state.channel
+		endpoint.mu.Unlock()
+
+		go endpoint.reconnect(old)
+	}
+}
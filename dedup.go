@@ -0,0 +1,75 @@
+package remit
+
+import (
+	"sync"
+	"time"
+)
+
+// SeenStore records which messages have already been handled, used by
+// endpoints with `EndpointOptions.Dedup` set to skip redelivered messages.
+//
+// The default is an in-memory store created with `NewMemorySeenStore`, but
+// a shared store (such as Redis) can be used to dedupe across processes.
+type SeenStore interface {
+	// Seen returns whether the message with ID `id` has been handled.
+	Seen(id string) bool
+
+	// Mark records that the message with ID `id` has been handled, remembering
+	// it for at least `ttl`.
+	Mark(id string, ttl time.Duration)
+}
+
+// MemorySeenStore is a `SeenStore` holding message IDs in memory.
+type MemorySeenStore struct {
+	mu        *sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemorySeenStore creates an empty `MemorySeenStore`.
+func NewMemorySeenStore() *MemorySeenStore {
+	return &MemorySeenStore{
+		mu:        &sync.Mutex{},
+		seen:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Seen returns whether `id` has been marked and not yet expired.
+func (store *MemorySeenStore) Seen(id string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	expires, ok := store.seen[id]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(expires) {
+		delete(store.seen, id)
+		return false
+	}
+
+	return true
+}
+
+// Mark remembers `id` for `ttl`, periodically forgetting expired IDs.
+func (store *MemorySeenStore) Mark(id string, ttl time.Duration) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	store.seen[id] = now.Add(ttl)
+
+	if now.Sub(store.lastSweep) < time.Minute {
+		return
+	}
+
+	for key, expires := range store.seen {
+		if now.After(expires) {
+			delete(store.seen, key)
+		}
+	}
+
+	store.lastSweep = now
+}
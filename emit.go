@@ -1,8 +1,7 @@
 package remit
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -20,17 +19,48 @@ type Emit struct {
 	Channel chan interface{}
 
 	RoutingKey string
+	Delay      time.Duration
+	Expiration time.Duration
+	Priority   uint8
+	Persistent bool
+	Headers    amqp.Table
 }
 
 // EmitOptions is a list of options that can be passed when setting up
 // an emission.
 type EmitOptions struct {
 	RoutingKey string
+
+	// Delay is how long the broker should wait before delivering each message.
+	// This requires the `rabbitmq_delayed_message_exchange` plugin, unless
+	// `ConnectionOptions.DelayWithTTL` is set.
+	// See `Session.EmitDelayed` for more info.
+	Delay time.Duration
+
+	// Expiration is how long each message can wait in a queue before being
+	// dropped or dead-lettered. Zero, the default, means it never expires.
+	Expiration time.Duration
+
+	// Priority is the priority of each message, used by queues declared with
+	// `EndpointOptions.MaxPriority`.
+	Priority uint8
+
+	// Persistent asks the broker to write each message to disk, so that it
+	// survives a broker restart if routed to a durable queue.
+	Persistent bool
+
+	// Headers are sent along with each message as AMQP headers.
+	Headers amqp.Table
 }
 
 func createEmission(session *Session, options EmitOptions) Emit {
 	emit := Emit{
 		RoutingKey: options.RoutingKey,
+		Delay:      options.Delay,
+		Expiration: options.Expiration,
+		Priority:   options.Priority,
+		Persistent: options.Persistent,
+		Headers:    options.Headers,
 		session:    session,
 		Channel:    make(chan interface{}),
 	}
@@ -40,38 +70,88 @@ func createEmission(session *Session, options EmitOptions) Emit {
 	return emit
 }
 
-func (emit *Emit) send(data interface{}) {
-	emit.session.waitGroup.Add(1)
-	defer emit.session.waitGroup.Done()
+func (emit *Emit) send(data interface{}) (err error) {
+	err = emit.session.hold(1)
+	if err != nil {
+		return err
+	}
+	defer emit.session.release()
+
+	ctx, endSpan := emit.session.Config.Tracer.StartSpan(context.Background(), SpanKindProducer, emit.RoutingKey)
+	defer func() {
+		endSpan(err)
+	}()
+
+	headers := amqp.Table{}
+	for k, v := range emit.Headers {
+		headers[k] = v
+	}
+	emit.session.Config.Propagator.Inject(ctx, headers)
 
 	message := amqp.Publishing{
-		Headers:     amqp.Table{},
-		ContentType: "application/json",
-		Timestamp:   time.Now(),
-		MessageId:   ulid.MustNew(ulid.Now(), nil).String(),
-		AppId:       emit.session.Config.Name,
+		Headers:   headers,
+		Timestamp: time.Now(),
+		MessageId: ulid.MustNew(ulid.Now(), nil).String(),
+		AppId:     emit.session.Config.Name,
+		Priority:  emit.Priority,
 	}
 
 	if data != nil {
-		j, err := json.Marshal(data)
-		failOnError(err, "Failed making JSON from result")
-		message.Body = j
+		body, contentType, err := emit.session.Config.Serializer.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		err = emit.session.validate(emit.RoutingKey, body, emit.session.Config.Serializer)
+		if err != nil {
+			return err
+		}
+		message.Body = body
+		message.ContentType = contentType
+	}
+
+	if emit.Persistent {
+		message.DeliveryMode = amqp.Persistent
+	}
+
+	if emit.Expiration > 0 {
+		message.Expiration = expiration(emit.Expiration)
+	}
+
+	exchange := emit.session.Config.Exchange
+	key := emit.RoutingKey
+
+	if emit.Delay > 0 && emit.session.Config.DelayWithTTL {
+		exchange = ""
+		key, err = emit.session.delayQueue(emit.RoutingKey, emit.Delay)
+		if err != nil {
+			return err
+		}
+
+		message.Expiration = ""
+	} else if emit.Delay > 0 {
+		exchange, err = emit.session.delayedExchange()
+		if err != nil {
+			return err
+		}
+
+		message.Headers["x-delay"] = int64(emit.Delay / time.Millisecond)
 	}
 
-	err := emit.session.publishChannel.Publish(
-		"remit",         // exchange
-		emit.RoutingKey, // routing key / queue
-		false,           // mandatory
-		false,           // immediate
-		message,         // amqp.Publishing
+	return emit.session.publishers.publish(
+		exchange, // exchange
+		key,      // routing key / queue
+		message,  // amqp.Publishing
 	)
-	failOnError(err, "Failed to send emit message")
 }
 
 func (emit *Emit) waitForEmissions() {
 	for data := range emit.Channel {
-		emit.send(data)
+		err := emit.send(data)
+		if err != nil {
+			emit.session.reportError("Failed to send emit message", err, "routingKey", emit.RoutingKey)
+		}
 	}
 
-	fmt.Println("finished")
+	emit.session.Config.Logger.Debug("Finished emitting", "routingKey", emit.RoutingKey)
 }
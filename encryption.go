@@ -0,0 +1,161 @@
+package remit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+// keyIdHeader carries the ID of the key a message's body was encrypted with.
+// Messages without it aren't encrypted.
+const keyIdHeader = "x-remit-key-id"
+
+// Encryptor encrypts message bodies before they're published, so that they
+// can't be read whilst sat in queues, set using `ConnectionOptions.Encryptor`.
+//
+// `Encrypt` returns the encrypted body along with the ID of the key used,
+// which is sent with the message so that the receiver's `Decryptor` knows
+// which key to decrypt it with.
+//
+// Bodies are encrypted after being serialized and compressed, so a message
+// is published with the `ContentType` and `ContentEncoding` of the plain body
+// and an `x-remit-key-id` header holding the key ID. Any service, in any
+// language, that reads that header and decrypts the body can then handle it
+// as usual.
+type Encryptor interface {
+	Encrypt(body []byte) ([]byte, string, error)
+}
+
+// Decryptor decrypts the bodies of messages received with an
+// `x-remit-key-id` header, set using `ConnectionOptions.Decryptor`.
+//
+// `Decrypt` is given the encrypted body and the ID of the key it was
+// encrypted with, as returned by the sender's `Encryptor`.
+type Decryptor interface {
+	Decrypt(body []byte, keyId string) ([]byte, error)
+}
+
+// AESGCM is an `Encryptor` and `Decryptor` using AES-GCM.
+//
+// Messages are encrypted with the key in `Keys` named by `KeyId`, and can be
+// decrypted with any key in `Keys`, so keys can be rotated by adding a new
+// one and switching `KeyId` over to it once every service knows it. Keys
+// must be 16, 24 or 32 bytes long, to use AES-128, AES-192 or AES-256.
+//
+// Each encrypted body is a random 12-byte nonce followed by the sealed body
+// and its 16-byte tag, with no additional data:
+//
+// 	nonce (12 bytes) | ciphertext | tag (16 bytes)
+//
+// For example:
+//
+// 	encryption := remit.AESGCM{
+// 		KeyId: "2024-06",
+// 		Keys:  map[string][]byte{"2024-06": key},
+// 	}
+//
+// 	remitSession := remit.Connect(remit.ConnectionOptions{
+// 		Name:      "my-service",
+// 		Url:       "amqp://localhost",
+// 		Encryptor: encryption,
+// 		Decryptor: encryption,
+// 	})
+//
+type AESGCM struct {
+	KeyId string
+	Keys  map[string][]byte
+}
+
+// Encrypt seals `body` with the key named by `KeyId`.
+func (e AESGCM) Encrypt(body []byte) ([]byte, string, error) {
+	aead, err := e.aead(e.KeyId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return aead.Seal(nonce, nonce, body, nil), e.KeyId, nil
+}
+
+// Decrypt opens `body` with the key named by `keyId`.
+func (e AESGCM) Decrypt(body []byte, keyId string) ([]byte, error) {
+	aead, err := e.aead(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) < aead.NonceSize() {
+		return nil, errors.New("remit: encrypted body is too short")
+	}
+
+	nonce, sealed := body[:aead.NonceSize()], body[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+func (e AESGCM) aead(keyId string) (cipher.AEAD, error) {
+	key, ok := e.Keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("remit: unknown encryption key %q", keyId)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt encrypts the body of `message` using `encryptor`, if set, adding
+// the ID of the key used to its headers. Messages that are already encrypted,
+// such as those being retried, are left as they are.
+func encrypt(message *amqp.Publishing, encryptor Encryptor) error {
+	if encryptor == nil {
+		return nil
+	}
+
+	if _, ok := message.Headers[keyIdHeader]; ok {
+		return nil
+	}
+
+	body, keyId, err := encryptor.Encrypt(message.Body)
+	if err != nil {
+		return err
+	}
+
+	headers := amqp.Table{}
+	for k, v := range message.Headers {
+		headers[k] = v
+	}
+	headers[keyIdHeader] = keyId
+
+	message.Body = body
+	message.Headers = headers
+
+	return nil
+}
+
+// decrypt returns the body of `d`, decrypting it first with `decryptor` if it
+// was encrypted.
+func decrypt(d amqp.Delivery, decryptor Decryptor) ([]byte, error) {
+	keyId, ok := d.Headers[keyIdHeader].(string)
+	if !ok {
+		return d.Body, nil
+	}
+
+	if decryptor == nil {
+		return nil, ErrNoDecryptor
+	}
+
+	return decryptor.Decrypt(d.Body, keyId)
+}
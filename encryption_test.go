@@ -0,0 +1,134 @@
+package remit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestAESGCM(t *testing.T) {
+	keys := map[string][]byte{
+		"128": bytes.Repeat([]byte{1}, 16),
+		"192": bytes.Repeat([]byte{2}, 24),
+		"256": bytes.Repeat([]byte{3}, 32),
+	}
+
+	tests := []struct {
+		keyId string
+		body  []byte
+	}{
+		{"128", []byte(`{"hello":"world"}`)},
+		{"192", []byte(`{"hello":"world"}`)},
+		{"256", []byte(`{"hello":"world"}`)},
+		{"256", []byte{}},
+	}
+
+	for _, test := range tests {
+		encryption := AESGCM{KeyId: test.keyId, Keys: keys}
+
+		sealed, keyId, err := encryption.Encrypt(test.body)
+		if err != nil {
+			t.Fatalf("%s: %v", test.keyId, err)
+		}
+		if keyId != test.keyId {
+			t.Errorf("%s: encrypted with key %q", test.keyId, keyId)
+		}
+		if len(test.body) > 0 && bytes.Contains(sealed, test.body) {
+			t.Errorf("%s: body wasn't encrypted", test.keyId)
+		}
+		if len(sealed) != 12+len(test.body)+16 {
+			t.Errorf("%s: got %d encrypted bytes, want nonce, body and tag", test.keyId, len(sealed))
+		}
+
+		opened, err := AESGCM{Keys: keys}.Decrypt(sealed, keyId)
+		if err != nil {
+			t.Fatalf("%s: %v", test.keyId, err)
+		}
+		if !bytes.Equal(opened, test.body) {
+			t.Errorf("%s: decrypted %q, want %q", test.keyId, opened, test.body)
+		}
+	}
+}
+
+func TestAESGCMFailures(t *testing.T) {
+	encryption := AESGCM{
+		KeyId: "current",
+		Keys: map[string][]byte{
+			"current": bytes.Repeat([]byte{1}, 32),
+			"other":   bytes.Repeat([]byte{2}, 32),
+			"short":   []byte("too short"),
+		},
+	}
+
+	sealed, _, err := encryption.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name  string
+		body  []byte
+		keyId string
+	}{
+		{"unknown key", sealed, "missing"},
+		{"wrong key", sealed, "other"},
+		{"invalid key", sealed, "short"},
+		{"tampered", tampered, "current"},
+		{"truncated", sealed[:5], "current"},
+	}
+
+	for _, test := range tests {
+		_, err := encryption.Decrypt(test.body, test.keyId)
+		if err == nil {
+			t.Errorf("%s: decrypted without an error", test.name)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	encryption := AESGCM{
+		KeyId: "current",
+		Keys:  map[string][]byte{"current": bytes.Repeat([]byte{1}, 32)},
+	}
+
+	tests := []struct {
+		name      string
+		encryptor Encryptor
+		decryptor Decryptor
+		wantErr   error
+	}{
+		{"encrypted", encryption, encryption, nil},
+		{"plain", nil, encryption, nil},
+		{"plain without decryptor", nil, nil, nil},
+		{"encrypted without decryptor", encryption, nil, ErrNoDecryptor},
+	}
+
+	for _, test := range tests {
+		message := amqp.Publishing{Headers: amqp.Table{"x-custom": "kept"}, Body: []byte("body")}
+
+		err := encrypt(&message, test.encryptor)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		_, encrypted := message.Headers[keyIdHeader]
+		if encrypted != (test.encryptor != nil) {
+			t.Errorf("%s: got key id header = %v", test.name, encrypted)
+		}
+		if message.Headers["x-custom"] != "kept" {
+			t.Errorf("%s: lost existing headers", test.name)
+		}
+
+		body, err := decrypt(amqp.Delivery{Headers: message.Headers, Body: message.Body}, test.decryptor)
+		if err != test.wantErr {
+			t.Fatalf("%s: got error %v, want %v", test.name, err, test.wantErr)
+		}
+		if err == nil && string(body) != "body" {
+			t.Errorf("%s: got body %q", test.name, body)
+		}
+	}
+}
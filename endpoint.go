@@ -1,9 +1,10 @@
 package remit
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -16,52 +17,382 @@ import (
 // Most commonly, this is used to set up an endpoint that can be requested
 // using `Session.Request` or `Session.LazyRequest`.
 //
+// Copies of an endpoint, such as the one returned by `Session.LazyEndpoint`,
+// all share the same consumption, so pausing, resuming or closing any copy
+// does so for every one of them.
+//
 // For examples of Endpoint usage, see `Session.Endpoint` and `Session.LazyEndpoint`.
 type Endpoint struct {
 	// given properties
-	RoutingKey string
-	Queue      string
+	RoutingKey     string
+	RoutingKeys    []string
+	Exchange       string
+	ExchangeType   string
+	Queue          string
+	QueueArgs      amqp.Table
+	QueueType      QueueType
+	MaxPriority    uint8
+	NonDurable     bool
+	AutoDelete     bool
+	Exclusive      bool
+	PrefetchCount  int
+	PrefetchSize   int
+	ConsumerTag    string
+	HandlerTimeout time.Duration
+	ManualAck      bool
+	MaxConcurrency int
+
+	ReplyExpiration time.Duration
+
+	OnReplyUndeliverable func(Event)
+
+	MaxRetries           int
+	RetryBackoff         time.Duration
+	RetrySchedule        []time.Duration
+	DeadLetterRoutingKey string
+	OnFailure            FailurePolicy
+
+	PoisonThreshold int
+
+	Dedup      bool
+	DedupStore SeenStore
+	DedupTTL   time.Duration
+
+	Serializer   Serializer
+	RawMode      bool
+	Schema       Schema
+	InvalidQueue string
+
+	DeliverData  bool
+	DataBuffer   int
+	DropWhenFull bool
 
 	// generated properties
 	Data  chan Event
 	Ready chan bool
 
 	session       *Session
-	channel       *amqp.Channel
 	waitGroup     *sync.WaitGroup
 	mu            *sync.Mutex
-	consumerTag   string
+	reconnectMu   *sync.Mutex
 	dataListeners []chan Event
+	middleware    *[]Middleware
+	middlewareMu  *sync.Mutex
+	handlerSlots  chan bool
+	inFlight      *int64
 	shouldReply   bool
+	state         *endpointState
 }
 
+// endpointState is the part of an endpoint that changes once it's been
+// opened, shared between every copy of it so that opening, pausing or
+// closing any one of them is seen by them all. It's guarded by `Endpoint.mu`,
+// except for `ctx`, which is only replaced by `Endpoint.Open` once every
+// handler using it has finished.
+//
+// `data` and `ready` are the `Data` and `Ready` channels the endpoint was last
+// opened with, which are the ones closed when it's closed.
+type endpointState struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	channel     Channel
+	consumerTag string
+	data        chan Event
+	ready       chan bool
+	paused      bool
+	closed      bool
+}
+
+// QueueType is the type of queue an endpoint consumes from.
+type QueueType string
+
+const (
+	// QueueTypeClassic is RabbitMQ's original, single-node queue type.
+	QueueTypeClassic QueueType = "classic"
+
+	// QueueTypeQuorum is a queue replicated across the cluster, recommended
+	// for durable queues on RabbitMQ 3.8 and newer.
+	QueueTypeQuorum QueueType = "quorum"
+
+	// QueueTypeStream is an append-only log that messages aren't removed
+	// from once consumed.
+	QueueTypeStream QueueType = "stream"
+)
+
+// FailurePolicy is what an endpoint does with a message whose handler failed.
+type FailurePolicy int
+
+const (
+	// FailureReply replies to the requester with the failure and then
+	// acknowledges the message. This is the default.
+	FailureReply FailurePolicy = iota
+
+	// FailureRequeue nacks the message without replying, so the broker
+	// redelivers it to be tried again. Combine with `PoisonThreshold` to
+	// limit how many times that happens. Messages that have run out of
+	// `MaxRetries` are dead-lettered instead if `DeadLetterRoutingKey` is set.
+	FailureRequeue
+
+	// FailureDeadLetter nacks the message without replying or requeueing, so
+	// it's dead-lettered if `DeadLetterRoutingKey` is set and dropped if not.
+	FailureDeadLetter
+)
+
 // EndpointOptions is a list of options that can be passed when setting up an endpoint.
 type EndpointOptions struct {
 	RoutingKey string
 	Queue      string
 
+	// RoutingKeys binds the endpoint's queue to additional routing keys
+	// alongside `RoutingKey`.
+	RoutingKeys []string
+
+	// Exchange binds the endpoint's queue to a different exchange than the
+	// session's `ConnectionOptions.Exchange`, such as one owned by another
+	// system. It's expected to exist already unless ExchangeType is also
+	// given, in which case it's declared as that type.
+	Exchange     string
+	ExchangeType string
+
+	// QueueArgs are passed as arguments when declaring the endpoint's queue,
+	// such as `"x-max-length"` or `"x-queue-type"`.
+	QueueArgs amqp.Table
+
+	// QueueType is the type of queue declared for the endpoint. Quorum queues
+	// and streams are always durable and shared, so NonDurable, AutoDelete
+	// and Exclusive are ignored for them, and streams must be consumed with a
+	// PrefetchCount, which defaults to 100 if not set.
+	// Defaults to whatever the broker's default type is, usually classic.
+	QueueType QueueType
+
+	// MaxPriority declares the endpoint's queue as a priority queue, where
+	// messages with a higher `Priority`, up to this value, are handled first.
+	// Zero, the default, means priorities are ignored.
+	MaxPriority uint8
+
+	// NonDurable, AutoDelete and Exclusive change how the endpoint's queue is
+	// declared. By default it's durable, surviving broker restarts, and is
+	// shared between every consumer. For short-lived tools or tests, setting
+	// all three gives a queue that's removed as soon as it's no longer used.
+	NonDurable bool
+	AutoDelete bool
+	Exclusive  bool
+
+	// PrefetchCount and PrefetchSize limit how many messages (or bytes)
+	// can be unacknowledged by the endpoint at once.
+	// Zero values, the default, mean no limit.
+	PrefetchCount int
+	PrefetchSize  int
+
+	// ConsumerTag identifies the endpoint's consumer to RabbitMQ, such as in
+	// the management UI. Setting it to something like `"<app>-<hostname>"`
+	// makes it easier to tell which process owns a consumer.
+	// Defaults to a new ULID each time consumption starts.
+	ConsumerTag string
+
+	// HandlerTimeout is how long handlers have to deal with each event received.
+	// Once passed, the event's context is cancelled and the message is nacked
+	// and requeued.
+	// Zero, the default, means no deadline.
+	HandlerTimeout time.Duration
+
+	// ManualAck stops messages being acknowledged automatically once handled.
+	// Instead, handlers must call one of `Event.Ack`, `Event.Nack` or `Event.Reject`.
+	// If a `HandlerTimeout` is set and a message hasn't been acknowledged before
+	// it passes, it is nacked and requeued.
+	ManualAck bool
+
+	// MaxConcurrency limits how many messages the endpoint handles at once.
+	// Further messages wait to be handled rather than being picked up, so
+	// combining this with a PrefetchCount stops them building up in memory.
+	// Zero, the default, means no limit.
+	MaxConcurrency int
+
+	// ReplyExpiration is how long replies can wait to be received by the
+	// requester before being dropped, for results that are only useful if
+	// they arrive promptly.
+	// Zero, the default, means replies never expire.
+	ReplyExpiration time.Duration
+
+	// OnReplyUndeliverable is called with the event being handled if its
+	// requester's reply queue has gone by the time the reply is sent, usually
+	// because the requester gave up waiting. The message is still acknowledged.
+	OnReplyUndeliverable func(Event)
+
+	// MaxRetries is how many times a message is retried after a handler fails
+	// before the failure is replied to. Each retry waits twice as long as the
+	// last, starting at RetryBackoff, in a separate "<queue>:retry" queue.
+	// Retried messages keep the routing key they were first published with,
+	// as given by `Event.EventType`.
+	//
+	// RabbitMQ only expires messages from the front of a queue, so a message
+	// waiting out a long backoff in the retry queue holds up every message
+	// behind it, even those due sooner. Use RetrySchedule where that matters.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// RetrySchedule sets exactly how long to wait before each retry instead,
+	// with the last delay used for any retries beyond the end of it. If
+	// MaxRetries isn't set, a message is retried once for every delay.
+	//
+	// Each delay has its own "<queue>:retry:<ms>" queue, so a long delay never
+	// holds up a shorter one behind it.
+	RetrySchedule []time.Duration
+
+	// DeadLetterRoutingKey is where messages are sent once they've run out of
+	// retries or are rejected without being requeued. A queue of the same name
+	// is declared and bound to it, which `Endpoint.Redrive` moves messages
+	// back out of.
+	DeadLetterRoutingKey string
+
+	// OnFailure is what happens to a message once its handler has failed and
+	// it has no retries left. By default, the failure is replied to and the
+	// message acknowledged.
+	OnFailure FailurePolicy
+
+	// PoisonThreshold moves messages that have been redelivered more than this
+	// many times, as given by `Event.RedeliveryCount`, to a "<queue>:poison"
+	// queue instead of handling them again, so that one message that always
+	// fails can't be requeued forever.
+	// Zero, the default, means messages are never moved.
+	//
+	// Classic queues only flag that a message has been redelivered rather than
+	// counting how many times, so use a quorum queue (see `QueueArgs`) for
+	// thresholds above one.
+	PoisonThreshold int
+
+	// Dedup skips messages whose `MessageId` has already been handled by
+	// checking them against DedupStore, which defaults to an in-memory store.
+	// Handled message IDs are remembered for DedupTTL, 10 minutes by default.
+	Dedup      bool
+	DedupStore SeenStore
+	DedupTTL   time.Duration
+
+	// Serializer is used to decode messages received by the endpoint and
+	// encode its replies in place of the session's `Serializer`, for
+	// endpoints that deal in a different format to the rest of the service.
+	// Messages with a content type in `ConnectionOptions.Serializers` still
+	// use the serializer given there.
+	Serializer Serializer
+
+	// RawMode skips decoding message bodies with the session's `Serializer`,
+	// leaving `Event.Data` empty so handlers can decode `Event.Body` themselves.
+	// Useful for protobuf or other binary payloads.
+	RawMode bool
+
+	// Schema validates the data of every message received before it reaches
+	// any handlers, in place of any schema registered for the message's
+	// routing key in `ConnectionOptions.Schemas`. Messages that fail
+	// validation are logged and rejected without being requeued, so are
+	// dead-lettered if `DeadLetterRoutingKey` is set. Validation is skipped in
+	// `RawMode`.
+	Schema Schema
+
+	// InvalidQueue is a queue that messages failing validation are moved to
+	// instead of being rejected, keeping them apart from those that were
+	// dead-lettered after failing to be handled. Each has the reason it
+	// failed in its `x-remit-invalid-reason` header.
+	InvalidQueue string
+
+	// DeliverData sends every message received to `Endpoint.Data`, as an
+	// alternative to registering handlers with `Endpoint.OnData`. Events read
+	// from `Data` are handled the same way, by sending to `Event.Success`,
+	// `Event.Failure` or `Event.Next`.
+	//
+	// DataBuffer sets how many events `Data` can hold before delivery blocks.
+	// If DropWhenFull is set, messages arriving whilst it's full are instead
+	// replied to with a `RemitError` with the code `"data_buffer_full"`.
+	DeliverData  bool
+	DataBuffer   int
+	DropWhenFull bool
+
 	shouldReply bool
 }
 
 // EndpointDataHandler is the function spec needed for listening to endpoint data.
 type EndpointDataHandler func(Event)
 
+// Middleware wraps an EndpointDataHandler to run code around it, such as for
+// logging or authentication. See `Session.Use`.
+type Middleware func(next EndpointDataHandler) EndpointDataHandler
+
+// EndpointContextHandler is the function spec needed for listening to endpoint
+// data using `Endpoint.OnDataContext`.
+type EndpointContextHandler func(context.Context, Event)
+
+// EndpointFuncHandler is the function spec needed for listening to endpoint
+// data using `Endpoint.OnDataFunc`.
+type EndpointFuncHandler func(Event) (interface{}, error)
+
 // Close closes the endpoint, stopping message consumption and closing the endpoint's
 // receiving channel.
 //
 // It will cancel consumption, but wait for all unacked messages to be handled
-// before closing the channel, meaning no loss should occur.
+// before closing the channel, meaning no loss should occur. Handlers' contexts
+// aren't cancelled until then, so a handler that never finishes stops `Close`
+// from returning; set `EndpointOptions.HandlerTimeout` to bound how long that
+// can take.
 //
-// The endpoint can be reopened using `Endpoint.Open`.
-func (endpoint Endpoint) Close() {
-	err := endpoint.channel.Cancel(endpoint.consumerTag, false)
-	failOnError(err, "Failed to cancel consume channel for endpoint")
+// The endpoint can be reopened using `Endpoint.Open`. Closing an endpoint that's
+// already closed, or that was never opened, is safe and does nothing further.
+func (endpoint *Endpoint) Close() {
+	endpoint.mu.Lock()
+	if endpoint.state.closed {
+		endpoint.mu.Unlock()
+		return
+	}
+
+	// the channel may already have been lost, in which case there's
+	// nothing left to cancel or close
+	if endpoint.state.channel != nil {
+		err := endpoint.state.channel.Cancel(endpoint.state.consumerTag, false)
+		if err != nil && err != amqp.ErrClosed {
+			endpoint.session.reportError("Failed to cancel consume channel for endpoint", err, "queue", endpoint.Queue)
+		}
+	}
+	endpoint.mu.Unlock()
+
+	// handlers may pause or resume the endpoint as they finish, so they're
+	// waited for without holding `mu`
 	endpoint.waitGroup.Wait()
-	err = endpoint.channel.Close()
-	failOnError(err, "Failed to close consume channel for endpoint")
-	endpoint.channel = nil
-	close(endpoint.Data)
-	close(endpoint.Ready)
+
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	// closed by another call whilst waiting
+	if endpoint.state.closed {
+		return
+	}
+
+	if endpoint.state.channel != nil {
+		err := endpoint.state.channel.Close()
+		if err != nil && err != amqp.ErrClosed {
+			endpoint.session.reportError("Failed to close consume channel for endpoint", err, "queue", endpoint.Queue)
+		}
+		endpoint.state.channel = nil
+	}
+
+	endpoint.state.cancel()
+	close(endpoint.state.data)
+	close(endpoint.state.ready)
+	endpoint.state.closed = true
+	endpoint.session.untrackEndpoint(endpoint)
+}
+
+// stopConsuming cancels consumption without closing the endpoint, leaving
+// in-flight messages to be handled.
+func (endpoint *Endpoint) stopConsuming() {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	if endpoint.state.channel == nil {
+		return
+	}
+
+	err := endpoint.state.channel.Cancel(endpoint.state.consumerTag, false)
+	if err != nil {
+		endpoint.session.Config.Logger.Warn("Failed to cancel endpoint consumption", "queue", endpoint.Queue, "error", err)
+	}
 }
 
 // OnData is used to register a data handler for a particular endpoint.
@@ -82,8 +413,9 @@ func (endpoint Endpoint) Close() {
 // Otherwise, sending `true` to `Event.Next` should be performed to indicate that
 // it's safe to move to the next step.
 //
-// If `Event.Next` is pushed to on the final handler, the message will be treated
-// as successful but the reply will contain no data.
+// If `Event.Next` is pushed to on the final handler, no handler has dealt with
+// the message and it will be replied to with `ErrNoHandlerMatched`, so that the
+// requester can tell it apart from a successful reply containing no data.
 func (endpoint *Endpoint) OnData(handlers ...EndpointDataHandler) {
 	if len(handlers) == 0 {
 		panic("Failed to create endpoint data handler with no functions")
@@ -96,207 +428,1069 @@ func (endpoint *Endpoint) OnData(handlers ...EndpointDataHandler) {
 
 	go func() {
 		for event := range dataChan {
+			if endpoint.handlerSlots != nil {
+				endpoint.handlerSlots <- true
+			}
+
 			go handleData(*endpoint, handlers, event)
 		}
 	}()
 }
 
+// Use adds middleware that wraps every handler run by this endpoint, just like
+// `Session.Use` does for the whole session. The session's middleware runs
+// first, followed by the endpoint's in the order it's added.
+//
+// 	endpoint.Use(func(next remit.EndpointDataHandler) remit.EndpointDataHandler {
+// 		return func(event remit.Event) {
+// 			started := time.Now()
+// 			next(event)
+// 			log.Println(event.EventType, "took", time.Since(started))
+// 		}
+// 	})
+//
+func (endpoint *Endpoint) Use(middleware ...Middleware) {
+	endpoint.middlewareMu.Lock()
+	defer endpoint.middlewareMu.Unlock()
+
+	*endpoint.middleware = append(*endpoint.middleware, middleware...)
+}
+
+// wrap applies all middleware added via `Endpoint.Use` to `handler`.
+func (endpoint Endpoint) wrap(handler EndpointDataHandler) EndpointDataHandler {
+	endpoint.middlewareMu.Lock()
+	middleware := *endpoint.middleware
+	endpoint.middlewareMu.Unlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+// InFlight returns how many messages the endpoint is currently handling, which
+// can be used to shed load or report how busy the endpoint is.
+func (endpoint *Endpoint) InFlight() int {
+	return int(atomic.LoadInt64(endpoint.inFlight))
+}
+
+// OnDataContext is the same as `Endpoint.OnData`, but each handler is also given
+// the context of the event being handled, as returned by `Event.Context`.
+//
+// The context is cancelled when the message has been handled, and has a
+// deadline if `EndpointOptions.HandlerTimeout` was set or the requester gave
+// one. If the requester's deadline passes before a handler replies, the
+// message is dropped without waiting for the handler to finish.
+//
+// 	endpoint.OnDataContext(func(ctx context.Context, event remit.Event) {
+// 		result, err := db.QueryContext(ctx, ...)
+// 		...
+// 	})
+//
+func (endpoint *Endpoint) OnDataContext(handlers ...EndpointContextHandler) {
+	wrapped := make([]EndpointDataHandler, len(handlers))
+
+	for i, handler := range handlers {
+		handler := handler
+
+		wrapped[i] = func(event Event) {
+			handler(event.Context(), event)
+		}
+	}
+
+	endpoint.OnData(wrapped...)
+}
+
+// OnDataFunc registers a data handler that returns its result rather than
+// sending it to `Event.Success` or `Event.Failure`. A non-nil error is sent to
+// `Event.Failure`; otherwise the result is sent to `Event.Success`.
+//
+// 	endpoint.OnDataFunc(func(event remit.Event) (interface{}, error) {
+// 		user, err := db.GetUser(event.Data["id"])
+// 		if err != nil {
+// 			return nil, err
+// 		}
+//
+// 		return user, nil
+// 	})
+//
+func (endpoint *Endpoint) OnDataFunc(handler EndpointFuncHandler) {
+	endpoint.OnData(func(event Event) {
+		result, err := handler(event)
+		if err != nil {
+			event.Failure <- err
+			return
+		}
+
+		event.Success <- result
+	})
+}
+
 // Open the endpoint to messages, starting consumption and pushing `true` to
 // `Endpoint.Ready` upon completion.
 //
-// The recommendation here is to ensure any and all data handlers are registered
-// before opening the endpoint up.
-func (endpoint *Endpoint) Open() {
-	endpoint.Data = make(chan Event)
-	endpoint.Ready = make(chan bool)
+// `Endpoint.Ready` is buffered, so it's safe to read from it either before or
+// after `Open` has been called:
+//
+// 	endpoint.Open()
+// 	<-endpoint.Ready
+//
+// Any and all data handlers must be registered before opening the endpoint up.
+// Messages received by an endpoint with no handlers are requeued, waiting
+// longer before each one as set by `ConnectionOptions.Backoff`.
+//
+// If any of the steps needed to start consumption fail, the error is returned
+// and the endpoint is left closed, so opening can be retried or skipped.
+func (endpoint *Endpoint) Open() error {
+	// a closed endpoint has had its channels closed, so needs fresh ones
+	endpoint.mu.Lock()
+	if endpoint.state.closed {
+		endpoint.Data = make(chan Event, endpoint.DataBuffer)
+		endpoint.Ready = make(chan bool, 1)
+		endpoint.state.ctx, endpoint.state.cancel = context.WithCancel(context.Background())
+		endpoint.state.data = endpoint.Data
+		endpoint.state.ready = endpoint.Ready
+		endpoint.state.closed = false
+	}
+	endpoint.mu.Unlock()
+
+	err := endpoint.consume()
+	if err != nil {
+		return err
+	}
+
+	endpoint.session.trackEndpoint(endpoint)
+
+	// `Ready` is buffered, so this only skips if a previous
+	// signal is still waiting to be read
+	select {
+	case endpoint.Ready <- true:
+	default:
+	}
+
+	return nil
+}
+
+// consume declares and binds the endpoint's queue before starting consumption
+// on a fresh channel.
+func (endpoint *Endpoint) consume() error {
+	workChannel, err := endpoint.session.workerPool.get()
+	if err != nil {
+		return fmt.Errorf("failed to get work channel: %s", err)
+	}
 
-	workChannel := endpoint.session.workerPool.get()
 	queue, err := workChannel.QueueDeclare(
+		endpoint.Queue,            // name of the queue
+		!endpoint.NonDurable,      // durable
+		endpoint.AutoDelete,       // autoDelete
+		endpoint.Exclusive,        // exclusive
+		false,                     // noWait
+		endpoint.queueArguments(), // arguments
+	)
+	if err != nil {
+		endpoint.session.workerPool.drop(workChannel)
+		return fmt.Errorf("could not create endpoint queue: %s", err)
+	}
+	endpoint.Queue = queue.Name
+
+	if endpoint.Exchange != "" && endpoint.ExchangeType != "" {
+		err = endpoint.session.declareExchange(workChannel, endpoint.Exchange, endpoint.ExchangeType, nil)
+		if err != nil {
+			endpoint.session.workerPool.drop(workChannel)
+			return fmt.Errorf("failed to declare %q exchange: %s", endpoint.Exchange, err)
+		}
+	}
+
+	for _, routingKey := range endpoint.routingKeys() {
+		err = workChannel.QueueBind(
+			endpoint.Queue,      // name of the queue
+			routingKey,          // routing key to use
+			endpoint.exchange(), // exchange
+			false,               // noWait
+			nil,                 // arguments
+		)
+		if err != nil {
+			endpoint.session.workerPool.drop(workChannel)
+			return fmt.Errorf("could not bind queue to routing key %q: %s", routingKey, err)
+		}
+	}
+
+	err = endpoint.declareRetryQueues(workChannel)
+	if err != nil {
+		endpoint.session.workerPool.drop(workChannel)
+		return err
+	}
+
+	endpoint.session.workerPool.release(workChannel)
+
+	channel, err := endpoint.session.connection.get().Channel()
+	if err != nil {
+		return fmt.Errorf("failed to create channel for consumption: %s", err)
+	}
+
+	err = channel.Qos(
+		endpoint.PrefetchCount, // prefetch count
+		endpoint.PrefetchSize,  // prefetch size
+		false,                  // global
+	)
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("failed to set endpoint QoS: %s", err)
+	}
+
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	// closed whilst the queue was being declared
+	if endpoint.state.closed {
+		channel.Close()
+		return ErrEndpointClosed
+	}
+
+	// a paused endpoint only starts consuming again once resumed
+	if !endpoint.state.paused {
+		err = endpoint.startConsuming(channel)
+		if err != nil {
+			channel.Close()
+			return err
+		}
+	}
+
+	endpoint.state.channel = channel
+
+	// watch for consume channel closure or the broker cancelling consumption
+	go endpoint.watchForClose(channel, channel.NotifyClose(make(chan *amqp.Error, 1)))
+	go endpoint.watchForCancel(channel, channel.NotifyCancel(make(chan string, 1)))
+
+	return nil
+}
+
+// startConsuming starts delivering messages from the endpoint's queue on
+// `channel`. `endpoint.mu` must be held.
+func (endpoint *Endpoint) startConsuming(channel Channel) error {
+	consumerTag := endpoint.ConsumerTag
+	if consumerTag == "" {
+		consumerTag = ulid.MustNew(ulid.Now(), nil).String()
+	}
+
+	deliveries, err := channel.Consume(
 		endpoint.Queue, // name of the queue
-		true,           // durable
-		false,          // autoDelete
+		consumerTag,    // consumer tag
+		false,          // noAck
 		false,          // exclusive
+		false,          // noLocal
 		false,          // noWait
 		nil,            // arguments
 	)
-	failOnError(err, "Could not create endpoint queue")
-	endpoint.Queue = queue.Name
+	if err != nil {
+		return fmt.Errorf("failed trying to consume: %s", err)
+	}
 
-	err = workChannel.QueueBind(
-		endpoint.Queue,      // name of the queue
-		endpoint.RoutingKey, // routing key to use
-		"remit",             // exchange
-		false,               // noWait
-		nil,                 // arguments
-	)
-	failOnError(err, "Could not bind queue to routing key")
+	endpoint.state.consumerTag = consumerTag
 
-	endpoint.session.workerPool.release(workChannel)
+	go messageHandler(endpoint.state.ctx, *endpoint, deliveries)
 
-	endpoint.channel, err = endpoint.session.connection.Channel()
-	failOnError(err, "Failed to create channel for consumption")
+	return nil
+}
 
-	// watch for consume channel closure
-	waitForClose := make(chan *amqp.Error, 0)
-	endpoint.channel.NotifyClose(waitForClose)
+// Pause temporarily stops the endpoint receiving new messages, without closing
+// it or its queue. Messages already received are still handled as usual.
+//
+// Consumption is restarted with `Endpoint.Resume`. Pausing an endpoint that's
+// already paused does nothing.
+//
+// 	if endpoint.InFlight() > 100 {
+// 		endpoint.Pause()
+// 	}
+//
+func (endpoint *Endpoint) Pause() error {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
 
-	go func() {
-		err := <-waitForClose
-		panic(err)
-	}()
+	if endpoint.state.paused {
+		return nil
+	}
 
-	endpoint.consumerTag = ulid.MustNew(ulid.Now(), nil).String()
-	deliveries, err := endpoint.channel.Consume(
-		endpoint.Queue,       // name of the queue
-		endpoint.consumerTag, // consumer tag
-		false,                // noAck
-		false,                // exclusive
-		false,                // noLocal
-		false,                // noWait
-		nil,                  // arguments
-	)
+	endpoint.state.paused = true
 
-	failOnError(err, "Failed trying to consume")
+	if endpoint.state.channel == nil {
+		return nil
+	}
 
-	go messageHandler(*endpoint, deliveries)
+	return endpoint.state.channel.Cancel(endpoint.state.consumerTag, false)
+}
 
-	// Have made this non-blocking (so will ignore if
-	// no ready listener is set up).
-	// Do we want this? Or should we just return ready
-	// whenever the listener is set up?
-	select {
-	case endpoint.Ready <- true:
-	default:
+// Resume restarts consumption for an endpoint paused with `Endpoint.Pause`.
+func (endpoint *Endpoint) Resume() error {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	if !endpoint.state.paused {
+		return nil
+	}
+
+	if endpoint.state.channel != nil {
+		err := endpoint.startConsuming(endpoint.state.channel)
+		if err != nil {
+			return err
+		}
+	}
+
+	endpoint.state.paused = false
+
+	return nil
+}
+
+// queueArguments returns the arguments the endpoint's queue should be declared
+// with, adding dead-lettering of rejected messages if a dead-letter routing key
+// is set.
+func (endpoint *Endpoint) queueArguments() amqp.Table {
+	if endpoint.QueueArgs == nil && endpoint.QueueType == "" && endpoint.DeadLetterRoutingKey == "" && endpoint.MaxPriority == 0 {
+		return nil
 	}
+
+	args := amqp.Table{}
+	for k, v := range endpoint.QueueArgs {
+		args[k] = v
+	}
+
+	if endpoint.QueueType != "" {
+		args["x-queue-type"] = string(endpoint.QueueType)
+	}
+
+	if endpoint.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-exchange"] = endpoint.session.Config.Exchange
+		args["x-dead-letter-routing-key"] = endpoint.DeadLetterRoutingKey
+	}
+
+	if endpoint.MaxPriority > 0 {
+		args["x-max-priority"] = int32(endpoint.MaxPriority)
+	}
+
+	return args
+}
+
+// exchange returns the name of the exchange the endpoint's queue is bound to.
+func (endpoint *Endpoint) exchange() string {
+	if endpoint.Exchange != "" {
+		return endpoint.Exchange
+	}
+
+	return endpoint.session.Config.Exchange
+}
+
+// routingKeys returns every routing key the endpoint's queue should be
+// bound to, without duplicates.
+func (endpoint *Endpoint) routingKeys() []string {
+	seen := map[string]bool{}
+	keys := []string{}
+
+	for _, key := range append([]string{endpoint.RoutingKey}, endpoint.RoutingKeys...) {
+		if key == "" || seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// watchForClose waits for the endpoint's consume channel to close. If it was
+// closed unexpectedly, in-flight messages are allowed to finish before
+// consumption is restarted on a new channel.
+//
+// If the whole connection was lost, the session restores the endpoint itself
+// once it has reconnected.
+func (endpoint *Endpoint) watchForClose(channel Channel, closing chan *amqp.Error) {
+	err, ok := <-closing
+	if !ok || err == nil {
+		// closed intentionally via `Endpoint.Close`
+		return
+	}
+
+	endpoint.session.Config.Logger.Warn("Endpoint consume channel closed; reconnecting", "queue", endpoint.Queue, "error", err)
+	endpoint.waitGroup.Wait()
+	endpoint.reconnect(channel)
+}
+
+// watchForCancel waits for the broker to cancel the endpoint's consumer, such
+// as when its queue is deleted, and if so restarts consumption on a new
+// channel, declaring the queue again.
+func (endpoint *Endpoint) watchForCancel(channel Channel, cancels chan string) {
+	consumerTag, ok := <-cancels
+	if !ok {
+		return
+	}
+
+	endpoint.session.Config.Logger.Warn("Endpoint consumer cancelled by broker; reconnecting", "queue", endpoint.Queue, "consumerTag", consumerTag)
+
+	// let in-flight messages be acknowledged first, then close the channel
+	// ourselves so that `watchForClose` doesn't try to replace it too
+	endpoint.waitGroup.Wait()
+	channel.Close()
+	endpoint.reconnect(channel)
+}
+
+// reconnect keeps trying to replace the lost channel `old` for as long as the
+// connection is open, waiting between each attempt as set by `Config.Backoff`.
+func (endpoint *Endpoint) reconnect(old Channel) {
+	for attempt := 0; ; attempt++ {
+		time.Sleep(endpoint.session.Config.Backoff.Duration(attempt))
+
+		if endpoint.session.connection.get().IsClosed() {
+			return
+		}
+
+		err := endpoint.reconsume(old)
+		if err == nil {
+			endpoint.session.Config.Metrics.ReconnectOccurred()
+			return
+		}
+
+		endpoint.session.reportError("Failed to reconnect endpoint consume channel", err, "queue", endpoint.Queue, "attempt", attempt+1)
+	}
+}
+
+// reconsume restarts consumption to replace the lost channel `old`, unless
+// it has already been replaced or the endpoint has since been closed.
+func (endpoint *Endpoint) reconsume(old Channel) error {
+	endpoint.reconnectMu.Lock()
+	defer endpoint.reconnectMu.Unlock()
+
+	endpoint.mu.Lock()
+	current := endpoint.state.channel
+	closed := endpoint.state.closed
+	endpoint.mu.Unlock()
+
+	if closed || current != old {
+		return nil
+	}
+
+	err := endpoint.consume()
+	if err == ErrEndpointClosed {
+		return nil
+	}
+
+	return err
 }
 
 func createEndpoint(session *Session, options EndpointOptions) Endpoint {
 	endpoint := Endpoint{
-		RoutingKey:  options.RoutingKey,
-		Queue:       options.Queue,
-		session:     session,
-		Data:        make(chan Event),
-		Ready:       make(chan bool),
-		waitGroup:   &sync.WaitGroup{},
-		mu:          &sync.Mutex{},
-		shouldReply: options.shouldReply,
+		RoutingKey:     options.RoutingKey,
+		RoutingKeys:    options.RoutingKeys,
+		Exchange:       options.Exchange,
+		ExchangeType:   options.ExchangeType,
+		Queue:          options.Queue,
+		QueueArgs:      options.QueueArgs,
+		QueueType:      options.QueueType,
+		MaxPriority:    options.MaxPriority,
+		NonDurable:     options.NonDurable,
+		AutoDelete:     options.AutoDelete,
+		Exclusive:      options.Exclusive,
+		PrefetchCount:  options.PrefetchCount,
+		PrefetchSize:   options.PrefetchSize,
+		ConsumerTag:    options.ConsumerTag,
+		HandlerTimeout: options.HandlerTimeout,
+		ManualAck:      options.ManualAck,
+		MaxConcurrency: options.MaxConcurrency,
+
+		ReplyExpiration: options.ReplyExpiration,
+
+		OnReplyUndeliverable: options.OnReplyUndeliverable,
+
+		MaxRetries:           options.MaxRetries,
+		RetryBackoff:         options.RetryBackoff,
+		RetrySchedule:        options.RetrySchedule,
+		DeadLetterRoutingKey: options.DeadLetterRoutingKey,
+		OnFailure:            options.OnFailure,
+
+		PoisonThreshold: options.PoisonThreshold,
+
+		Dedup:      options.Dedup,
+		DedupStore: options.DedupStore,
+		DedupTTL:   options.DedupTTL,
+
+		Serializer:   options.Serializer,
+		RawMode:      options.RawMode,
+		Schema:       options.Schema,
+		InvalidQueue: options.InvalidQueue,
+
+		DeliverData:  options.DeliverData,
+		DataBuffer:   options.DataBuffer,
+		DropWhenFull: options.DropWhenFull,
+
+		session:      session,
+		Data:         make(chan Event, options.DataBuffer),
+		Ready:        make(chan bool, 1),
+		waitGroup:    &sync.WaitGroup{},
+		mu:           &sync.Mutex{},
+		reconnectMu:  &sync.Mutex{},
+		middleware:   &[]Middleware{},
+		middlewareMu: &sync.Mutex{},
+		inFlight:     new(int64),
+		shouldReply:  options.shouldReply,
+		state:        &endpointState{},
+	}
+
+	if endpoint.MaxRetries == 0 {
+		endpoint.MaxRetries = len(endpoint.RetrySchedule)
 	}
 
+	if endpoint.QueueType == QueueTypeQuorum || endpoint.QueueType == QueueTypeStream {
+		endpoint.NonDurable = false
+		endpoint.AutoDelete = false
+		endpoint.Exclusive = false
+	}
+
+	if endpoint.QueueType == QueueTypeStream && endpoint.PrefetchCount == 0 {
+		endpoint.PrefetchCount = 100
+	}
+
+	if endpoint.MaxConcurrency > 0 {
+		endpoint.handlerSlots = make(chan bool, endpoint.MaxConcurrency)
+	}
+
+	if endpoint.Dedup && endpoint.DedupStore == nil {
+		endpoint.DedupStore = NewMemorySeenStore()
+	}
+
+	if endpoint.Dedup && endpoint.DedupTTL == 0 {
+		endpoint.DedupTTL = 10 * time.Minute
+	}
+
+	endpoint.state.ctx, endpoint.state.cancel = context.WithCancel(context.Background())
+	endpoint.state.data = endpoint.Data
+	endpoint.state.ready = endpoint.Ready
+
 	return endpoint
 }
 
+// handleData runs `handlers` for `event` before replying and acknowledging it.
+// The session's and endpoint's wait groups must have already been added to
+// for the call by `messageHandler`.
 func handleData(endpoint Endpoint, handlers []EndpointDataHandler, event Event) {
-	endpoint.session.waitGroup.Add(1)
-	defer endpoint.session.waitGroup.Done()
-	endpoint.waitGroup.Add(1)
+	defer endpoint.session.release()
 	defer endpoint.waitGroup.Done()
-	event.waitGroup.Add(1)
-	defer event.waitGroup.Done()
+	atomic.AddInt64(endpoint.session.inFlight, 1)
+	defer atomic.AddInt64(endpoint.session.inFlight, -1)
+	atomic.AddInt64(endpoint.inFlight, 1)
+	defer atomic.AddInt64(endpoint.inFlight, -1)
+
+	if endpoint.handlerSlots != nil {
+		defer func() {
+			<-endpoint.handlerSlots
+		}()
+	}
+
+	ctx := endpoint.session.Config.Propagator.Extract(endpoint.state.ctx, event.message.Headers)
+	ctx, endSpan := endpoint.session.Config.Tracer.StartSpan(ctx, SpanKindConsumer, event.EventType)
+
+	if deadline, ok := requestDeadline(event.message.Headers); ok {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, deadline)
+		defer cancelDeadline()
+	}
+
+	var cancel context.CancelFunc
+	if endpoint.HandlerTimeout > 0 {
+		event.ctx, cancel = context.WithTimeout(ctx, endpoint.HandlerTimeout)
+	} else {
+		event.ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	if endpoint.shouldReply && event.message.ReplyTo != "" && event.message.CorrelationId != "" {
+		event.progress = func(data interface{}) error {
+			return endpoint.sendProgress(event, data)
+		}
+	}
+
+	var timeout <-chan time.Time
+	if endpoint.HandlerTimeout > 0 {
+		timer := time.NewTimer(endpoint.HandlerTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
 	var retResult interface{}
 	var retErr interface{}
+	handled := false
+	started := time.Now()
+
+	outcome := "success"
+	replyOutcome := "none"
+	defer func() {
+		endSpan(outcomeError(outcome, retErr))
+	}()
+	if endpoint.session.Config.AccessLog {
+		defer func() {
+			endpoint.session.Config.Logger.Info(
+				"Handled message",
+				"routingKey", event.EventType,
+				"messageId", event.EventId,
+				"correlationId", event.message.CorrelationId,
+				"duration", time.Since(started),
+				"outcome", outcome,
+				"reply", replyOutcome,
+			)
+		}()
+	}
+
+	timedOut := func() {
+		outcome = "timeout"
+		endpoint.session.Config.Metrics.MessageProcessed(endpoint.Queue, event.EventType, time.Since(started), context.DeadlineExceeded)
+		if event.Nack(true) != ErrAlreadyAcknowledged {
+			endpoint.session.Config.Logger.Warn("Handler timed out; requeueing message", "routingKey", event.EventType, "messageId", event.EventId, "timeout", endpoint.HandlerTimeout)
+		}
+	}
 
 runner:
 	for _, handler := range handlers {
-		go handler(event)
+		go runHandler(endpoint, endpoint.session.wrap(endpoint.wrap(handler)), event)
 
 		select {
 		case retResult = <-event.Success:
+			handled = true
 			break runner
 		case retErr = <-event.Failure:
+			handled = true
 			break runner
 		case <-event.Next:
+		case <-timeout:
+			timedOut()
+			return
+		case <-event.ctx.Done():
+			if !endpoint.cancelled(event) && event.ctx.Err() == context.DeadlineExceeded {
+				// only the handler timeout has passed
+				timedOut()
+				return
+			}
+
+			outcome = "cancelled"
+			endpoint.session.Config.Metrics.MessageProcessed(endpoint.Queue, event.EventType, time.Since(started), event.ctx.Err())
+			if event.Nack(true) != ErrAlreadyAcknowledged {
+				endpoint.session.Config.Logger.Warn("Handler cancelled; requeueing message", "routingKey", event.EventType, "messageId", event.EventId)
+			}
+			return
 		}
 	}
 
+	var processErr error
+	if retErr != nil {
+		outcome = "failure"
+		processErr = fmt.Errorf("%v", retErr)
+	} else if !handled {
+		outcome = "no_handler"
+		processErr = ErrNoHandlerMatched
+	}
+	endpoint.session.Config.Metrics.MessageProcessed(endpoint.Queue, event.EventType, time.Since(started), processErr)
+
+	if retErr != nil && endpoint.MaxRetries > 0 && endpoint.retry(event) {
+		replyOutcome = "retried"
+		return
+	}
+
+	if retErr != nil && endpoint.OnFailure != FailureReply {
+		replyOutcome = endpoint.settleFailure(event)
+		return
+	}
+
+	if !handled {
+		retErr = RemitError{Code: "no_handler_matched", Message: ErrNoHandlerMatched.Error()}
+	}
+
 	if !endpoint.shouldReply || event.message.ReplyTo == "" || event.message.CorrelationId == "" {
-		event.message.Ack(false)
+		endpoint.ack(event, timeout)
+		return
+	}
+
+	headers := amqp.Table{}
+	event.replyHeaders.mu.Lock()
+	for k, v := range event.replyHeaders.table {
+		headers[k] = v
+	}
+	event.replyHeaders.mu.Unlock()
+	endpoint.session.Config.Propagator.Inject(event.ctx, headers)
+
+	var body []byte
+	var contentType string
+	var err error
+
+	replyOutcome = "failed"
+
+	if raw, ok := retResult.(RawReply); ok && retErr == nil {
+		body = raw.Body
+		contentType = raw.ContentType
+		headers[rawReplyHeader] = true
+	} else {
+		var accumulatedResults [2]interface{}
+		if retErr != nil {
+			accumulatedResults[0] = newRemitError(retErr)
+		}
+		accumulatedResults[1] = retResult
+
+		body, contentType, err = event.serializer.Marshal(accumulatedResults)
+		if err != nil {
+			endpoint.session.reportError("Failed serializing result; rejecting message", err, "routingKey", event.EventType, "messageId", event.EventId)
+			event.Reject(false)
+			return
+		}
+	}
+
+	found, err := endpoint.session.replyQueueExists(event.message.ReplyTo)
+	if err != nil {
+		endpoint.session.reportError("Failed to get work channel for reply; requeueing message", err, "routingKey", event.EventType, "messageId", event.EventId)
+		event.Nack(true)
+		return
+	}
+	if !found {
+		endpoint.session.Config.Logger.Info("Reply consumer no longer present; skipping", "replyTo", event.message.ReplyTo, "correlationId", event.message.CorrelationId)
+		if endpoint.OnReplyUndeliverable != nil {
+			endpoint.OnReplyUndeliverable(event)
+		}
+		replyOutcome = "undeliverable"
+		endpoint.ack(event, timeout)
 		return
 	}
 
-	var accumulatedResults [2]interface{}
-	accumulatedResults[0] = retErr
-	accumulatedResults[1] = retResult
+	reply := amqp.Publishing{
+		Headers:       headers,
+		ContentType:   contentType,
+		Body:          body,
+		Timestamp:     time.Now(),
+		MessageId:     ulid.MustNew(ulid.Now(), nil).String(),
+		AppId:         endpoint.session.Config.Name,
+		CorrelationId: event.message.CorrelationId,
 
-	j, err := json.Marshal(accumulatedResults)
-	failOnError(err, "Failed making JSON from result")
+		// replies are as urgent as the requests they answer
+		Priority: event.message.Priority,
+	}
+
+	if endpoint.ReplyExpiration > 0 {
+		reply.Expiration = expiration(endpoint.ReplyExpiration)
+	}
 
-	// fmt.Println(event.message.DeliveryTag, "queuing")
-	// fmt.Println(event.message.DeliveryTag, "checking")
-	workChannel := endpoint.session.workerPool.get()
-	queue, err := workChannel.QueueDeclarePassive(
-		event.message.ReplyTo, // the queue to assert
-		false, // durable
-		true,  // autoDelete
-		true,  // exclusive
-		false, // noWait
-		nil,   // arguments
+	// published on the same channel as any progress updates, so that the
+	// reply can't overtake them
+	err = endpoint.session.publishers.publishOn(
+		event.message.CorrelationId,       // pin
+		endpoint.session.Config.Mandatory, // mandatory
+		"",                                // exchange - use default here to publish directly to queue
+		event.message.ReplyTo,             // routing key / queue
+		reply,                             // amqp.Publishing
 	)
+
 	if err != nil {
-		endpoint.session.workerPool.drop(workChannel)
-		fmt.Println("Reply consumer no longer present; skipping", err)
-		event.message.Ack(false)
+		endpoint.session.reportError("Failed to publish reply; requeueing message", err, "routingKey", event.EventType, "messageId", event.EventId, "correlationId", event.message.CorrelationId)
+		event.Nack(true)
 		return
 	}
 
-	endpoint.session.workerPool.release(workChannel)
+	replyOutcome = "sent"
+	endpoint.session.Config.Metrics.ReplyPublished(endpoint.Queue, event.EventType)
+	endpoint.ack(event, timeout)
+}
+
+// sendProgress publishes an interim reply for `event`, as sent by
+// `Event.Progress`.
+func (endpoint Endpoint) sendProgress(event Event, data interface{}) error {
+	body, contentType, err := event.serializer.Marshal([2]interface{}{nil, data})
+	if err != nil {
+		return err
+	}
 
-	err = endpoint.session.publishChannel.Publish(
-		"",         // exchange - use default here to publish directly to queue
-		queue.Name, // routing key / queue
-		false,      // mandatory
-		false,      // immediate
+	found, err := endpoint.session.replyQueueExists(event.message.ReplyTo)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrReplyQueueGone
+	}
+
+	headers := amqp.Table{progressHeader: true}
+	endpoint.session.Config.Propagator.Inject(event.ctx, headers)
+
+	return endpoint.session.publishers.publishOn(
+		event.message.CorrelationId, // pin
+		false,                       // mandatory
+		"",                          // exchange - use default here to publish directly to queue
+		event.message.ReplyTo,       // routing key / queue
 		amqp.Publishing{
-			Headers:       amqp.Table{},
-			ContentType:   "application/json",
-			Body:          j,
+			Headers:       headers,
+			ContentType:   contentType,
+			Body:          body,
 			Timestamp:     time.Now(),
 			MessageId:     ulid.MustNew(ulid.Now(), nil).String(),
 			AppId:         endpoint.session.Config.Name,
 			CorrelationId: event.message.CorrelationId,
-		},
+		}, // amqp.Publishing
 	)
+}
 
-	failOnError(err, "Couldn't send that message")
+// ack acknowledges a handled message, unless the endpoint is using manual
+// acknowledgements, in which case the handler is given until `timeout` to have
+// done so itself before the message is requeued.
+func (endpoint Endpoint) ack(event Event, timeout <-chan time.Time) {
+	if !endpoint.ManualAck {
+		event.Ack()
+		endpoint.markSeen(event)
+		return
+	}
+
+	if timeout == nil {
+		return
+	}
 
-	event.message.Ack(false)
+	select {
+	case <-event.acknowledgement.done:
+		endpoint.markSeen(event)
+	case <-timeout:
+		if event.Nack(true) != ErrAlreadyAcknowledged {
+			endpoint.session.Config.Logger.Warn("Handler didn't acknowledge message before timing out; requeueing", "routingKey", event.EventType, "messageId", event.EventId, "timeout", endpoint.HandlerTimeout)
+		}
+	}
+}
+
+// settleFailure nacks a failed message as set by `Endpoint.OnFailure` rather
+// than replying to it, returning the outcome to log.
+func (endpoint Endpoint) settleFailure(event Event) string {
+	requeue := endpoint.OnFailure == FailureRequeue
+
+	// a message that's run out of retries would only fail again, so it's
+	// dead-lettered rather than requeued if there's somewhere to send it
+	if requeue && endpoint.DeadLetterRoutingKey != "" && endpoint.MaxRetries > 0 && retryCount(event.message.Headers) >= endpoint.MaxRetries {
+		requeue = false
+	}
+
+	err := event.Nack(requeue)
+	if err != nil && err != ErrAlreadyAcknowledged {
+		endpoint.session.reportError("Failed to nack failed message", err, "routingKey", event.EventType, "messageId", event.EventId)
+	}
+
+	if requeue {
+		return "requeued"
+	}
+
+	return "rejected"
+}
+
+// cancelled settles a message whose context was cancelled before its handlers
+// finished, returning false if it wasn't due to the requester's deadline.
+//
+// If the requester's deadline has passed, no one is waiting for the reply any
+// more, so the message is acked and dropped.
+func (endpoint Endpoint) cancelled(event Event) bool {
+	if deadline, ok := requestDeadline(event.message.Headers); ok && !time.Now().Before(deadline) {
+		if event.Ack() != ErrAlreadyAcknowledged {
+			endpoint.session.Config.Logger.Debug("Message passed its deadline whilst being handled; dropping", "routingKey", event.EventType, "messageId", event.EventId, "deadline", deadline)
+		}
+
+		return true
+	}
+
+	return false
 }
 
-func messageHandler(endpoint Endpoint, deliveries <-chan amqp.Delivery) {
+// outcomeError returns the error a message's handling failed with, given its
+// outcome as logged by `AccessLog`.
+func outcomeError(outcome string, retErr interface{}) error {
+	switch outcome {
+	case "success":
+		return nil
+	case "failure":
+		return newRemitError(retErr)
+	case "no_handler":
+		return ErrNoHandlerMatched
+	case "timeout":
+		return context.DeadlineExceeded
+	default:
+		return context.Canceled
+	}
+}
+
+// serializerFor returns the serializer for `contentType`, falling back to the
+// endpoint's `Serializer` and then the session's.
+func (endpoint Endpoint) serializerFor(contentType string) Serializer {
+	if serializer, ok := endpoint.session.Config.Serializers[contentType]; ok {
+		return serializer
+	}
+
+	if endpoint.Serializer != nil {
+		return endpoint.Serializer
+	}
+
+	return endpoint.session.Config.Serializer
+}
+
+// markSeen records a handled message so it can be skipped if redelivered.
+func (endpoint Endpoint) markSeen(event Event) {
+	if endpoint.Dedup && event.EventId != "" {
+		endpoint.DedupStore.Mark(event.EventId, endpoint.DedupTTL)
+	}
+}
+
+// runHandler runs a single data handler, converting any panic in to a failure
+// so that the endpoint stays alive and the message is still replied to.
+func runHandler(endpoint Endpoint, handler EndpointDataHandler, event Event) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		endpoint.session.reportError("Handler panicked", fmt.Errorf("handler panicked: %v", r), "routingKey", event.EventType, "messageId", event.EventId)
+
+		select {
+		case event.Failure <- fmt.Sprint(r):
+		default:
+		}
+	}()
+
+	handler(event)
+}
+
+func messageHandler(ctx context.Context, endpoint Endpoint, deliveries <-chan amqp.Delivery) {
+	unhandled := 0
+
 	for d := range deliveries {
+		// retried and redriven messages are routed straight to the queue, so
+		// are given back the routing key they were first published with
+		if d.Exchange == "" {
+			d.RoutingKey = routingKey(d)
+		}
+
+		redeliveries := endpoint.redeliveryCount(d)
+
+		endpoint.session.Config.Metrics.MessageReceived(endpoint.Queue, d.RoutingKey)
+		if redeliveries > 0 {
+			endpoint.session.Config.Metrics.MessageRedelivered(endpoint.Queue, d.RoutingKey)
+		}
+
+		if len(endpoint.dataListeners) == 0 && !endpoint.DeliverData {
+			// wait longer before each requeue, so that messages aren't
+			// redelivered to this consumer as fast as it can nack them
+			delay := endpoint.session.Config.Backoff.Duration(unhandled)
+			unhandled++
+
+			endpoint.session.Config.Logger.Warn("No data handlers registered for endpoint; requeueing message", "queue", endpoint.Queue, "routingKey", d.RoutingKey, "messageId", d.MessageId, "delay", delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+
+			d.Nack(false, true)
+			continue
+		}
+
+		if endpoint.Dedup && d.MessageId != "" && endpoint.DedupStore.Seen(d.MessageId) {
+			endpoint.session.Config.Logger.Debug("Skipping duplicate message", "routingKey", d.RoutingKey, "messageId", d.MessageId)
+			d.Ack(false)
+			continue
+		}
+
+		if endpoint.PoisonThreshold > 0 {
+			if redeliveries > endpoint.PoisonThreshold {
+				endpoint.quarantine(d, redeliveries)
+				continue
+			}
+		}
+
+		if deadline, ok := requestDeadline(d.Headers); ok && time.Now().After(deadline) {
+			endpoint.session.Config.Logger.Debug("Skipping message past its deadline", "routingKey", d.RoutingKey, "messageId", d.MessageId, "deadline", deadline)
+			endpoint.session.Config.Metrics.MessageProcessed(endpoint.Queue, d.RoutingKey, 0, context.DeadlineExceeded)
+			d.Ack(false)
+			continue
+		}
+
+		serializer := endpoint.serializerFor(d.ContentType)
+
 		var parsedData EventData
-		err := json.Unmarshal(d.Body, &parsedData)
+		body, err := endpoint.session.messageBody(d)
+		if err == nil && !endpoint.RawMode {
+			err = serializer.Unmarshal(body, &parsedData)
+		}
 		if err != nil {
-			fmt.Println("Failed to parse JSON " + d.MessageId)
-			fmt.Println(err)
+			endpoint.session.Config.Logger.Warn("Failed to parse message", "routingKey", d.RoutingKey, "messageId", d.MessageId, "error", err)
 			d.Nack(false, false)
 			continue
 		}
 
+		if schema := endpoint.schemaFor(d.RoutingKey); schema != nil && !endpoint.RawMode {
+			err = schema.Validate(parsedData)
+			if err != nil && endpoint.InvalidQueue != "" {
+				endpoint.moveInvalid(d, err)
+				continue
+			}
+			if err != nil {
+				endpoint.session.Config.Logger.Warn("Message failed schema validation", "routingKey", d.RoutingKey, "messageId", d.MessageId, "error", err)
+				d.Nack(false, false)
+				continue
+			}
+		}
+
 		event := Event{
 			EventId:   d.MessageId,
 			EventType: d.RoutingKey,
 			Resource:  d.AppId,
 			Data:      parsedData,
+			Body:      body,
 			Success:   make(chan interface{}, 1),
 			Failure:   make(chan interface{}, 1),
 			Next:      make(chan bool, 1),
 
-			message:   d,
-			waitGroup: &sync.WaitGroup{},
+			message:         d,
+			serializer:      serializer,
+			acknowledgement: newAcknowledgement(false),
+			replyHeaders:    newReplyHeaders(),
+			redeliveries:    redeliveries,
 		}
 
-		event.waitGroup.Add(len(endpoint.dataListeners))
+		// the event's channels are deliberately never closed, as a handler
+		// that has timed out may still try to send to them
 
-		go func() {
-			event.waitGroup.Wait()
-			close(event.Success)
-			close(event.Failure)
-			close(event.Next)
-		}()
+		// count every handleData call this results in before any of them
+		// start, so closing can't miss one that's yet to begin
+		pending := len(endpoint.dataListeners)
+		if endpoint.DeliverData {
+			pending++
+		}
+		err = endpoint.session.hold(pending)
+		if err != nil {
+			// the session's closing, so leave the message for another consumer
+			d.Nack(false, true)
+			continue
+		}
+		endpoint.waitGroup.Add(pending)
 
 		for _, listener := range endpoint.dataListeners {
 			listener <- event
 		}
+
+		if endpoint.DeliverData {
+			if endpoint.handlerSlots != nil {
+				endpoint.handlerSlots <- true
+			}
+
+			go handleData(endpoint, []EndpointDataHandler{endpoint.deliverData}, event)
+		}
 	}
 }
+
+// deliverData is the handler used to pass events on to `Endpoint.Data`.
+func (endpoint Endpoint) deliverData(event Event) {
+	if endpoint.DropWhenFull {
+		select {
+		case endpoint.Data <- event:
+		default:
+			endpoint.session.Config.Logger.Warn("Data buffer full; dropping message", "routingKey", event.EventType, "messageId", event.EventId)
+			event.Failure <- RemitError{Code: "data_buffer_full", Message: "endpoint is too busy to handle the message"}
+		}
+
+		return
+	}
+
+	endpoint.Data <- event
+}
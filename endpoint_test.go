@@ -0,0 +1,468 @@
+package remit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// testSession connects a session to a fresh `MemoryTransport`, closing it
+// once the test has finished.
+func testSession(t *testing.T) Session {
+	t.Helper()
+
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}})
+	t.Cleanup(func() { session.Close(context.Background()) })
+
+	return session
+}
+
+func TestEndpointClose(t *testing.T) {
+	session := testSession(t)
+
+	started := make(chan bool)
+	endpoint := session.Endpoint("close.me")
+	endpoint.OnData(func(event Event) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+
+		// closing must not hold up handlers using the endpoint
+		endpoint.Pause()
+		endpoint.Resume()
+
+		event.Success <- nil
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.LazyEmit("close.me", J{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	closed := make(chan bool)
+	go func() {
+		endpoint.Close()
+		endpoint.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't return")
+	}
+
+	if endpoint.InFlight() != 0 {
+		t.Errorf("closed with %d messages still being handled", endpoint.InFlight())
+	}
+
+	// closing an endpoint that's already closed does nothing
+	endpoint.Close()
+
+	err = endpoint.Open()
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	endpoint.Close()
+}
+
+// processedMetrics passes the error of every processed message to `errs`.
+type processedMetrics struct {
+	NopMetrics
+	errs chan error
+}
+
+func (m processedMetrics) MessageProcessed(queue string, routingKey string, d time.Duration, err error) {
+	m.errs <- err
+}
+
+// cancellingPropagator gives the first message it sees a context that's
+// already been cancelled.
+type cancellingPropagator struct {
+	TraceContextPropagator
+	once *sync.Once
+}
+
+func (p cancellingPropagator) Extract(ctx context.Context, headers amqp.Table) context.Context {
+	p.once.Do(func() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		cancel()
+	})
+
+	return ctx
+}
+
+func TestHandlerCancelled(t *testing.T) {
+	metrics := processedMetrics{errs: make(chan error, 10)}
+	session := Connect(ConnectionOptions{
+		Name:       "test",
+		Transport:  NewMemoryTransport(),
+		Logger:     NopLogger{},
+		Metrics:    metrics,
+		Propagator: cancellingPropagator{once: &sync.Once{}},
+	})
+	defer session.Close(context.Background())
+
+	handled := make(chan bool, 1)
+	endpoint := session.Endpoint("cancel.me")
+	endpoint.OnData(func(event Event) {
+		select {
+		case <-event.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+			handled <- true
+			event.Success <- nil
+		}
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.LazyEmit("cancel.me", J{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-metrics.errs; err != context.Canceled {
+		t.Errorf("got error %v for the cancelled message, want %v", err, context.Canceled)
+	}
+
+	// it's requeued rather than dropped, so is handled once redelivered
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Error("cancelled message wasn't redelivered")
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	metrics := processedMetrics{errs: make(chan error, 10)}
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}, Metrics: metrics})
+	defer session.Close(context.Background())
+
+	redelivered := make(chan bool, 1)
+	endpoint := session.EndpointWithOptions(EndpointOptions{
+		RoutingKey:     "slow.job",
+		HandlerTimeout: 50 * time.Millisecond,
+	})
+	endpoint.OnData(func(event Event) {
+		if event.RedeliveryCount() > 0 {
+			redelivered <- true
+			event.Success <- nil
+			return
+		}
+
+		<-event.Context().Done()
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.LazyEmit("slow.job", J{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-metrics.errs; err != context.DeadlineExceeded {
+		t.Errorf("got error %v for the timed out message, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-redelivered:
+	case <-time.After(5 * time.Second):
+		t.Error("timed out message wasn't requeued")
+	}
+}
+
+func TestManualAck(t *testing.T) {
+	session := testSession(t)
+
+	deliveries := make(chan int, 10)
+	acked := make(chan error, 1)
+	endpoint := session.EndpointWithOptions(EndpointOptions{
+		RoutingKey:     "manual.job",
+		ManualAck:      true,
+		HandlerTimeout: 50 * time.Millisecond,
+	})
+	endpoint.OnData(func(event Event) {
+		deliveries <- event.RedeliveryCount()
+
+		// the first delivery is never acknowledged, so is requeued once the
+		// timeout has passed
+		if event.RedeliveryCount() > 0 {
+			event.Ack()
+			acked <- event.Ack()
+		}
+
+		event.Success <- nil
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.LazyEmit("manual.job", J{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for want := 0; want < 2; want++ {
+		select {
+		case got := <-deliveries:
+			if (got > 0) != (want > 0) {
+				t.Errorf("delivery %d: got redelivery count %d", want+1, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery %d never arrived", want+1)
+		}
+	}
+
+	if err := <-acked; err != ErrAlreadyAcknowledged {
+		t.Errorf("acknowledging twice: got %v, want %v", err, ErrAlreadyAcknowledged)
+	}
+
+	select {
+	case <-deliveries:
+		t.Error("acknowledged message was delivered again")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDeliverDataDropWhenFull(t *testing.T) {
+	session := testSession(t)
+
+	endpoint := session.EndpointWithOptions(EndpointOptions{
+		RoutingKey:   "busy.job",
+		DeliverData:  true,
+		DataBuffer:   1,
+		DropWhenFull: true,
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// nothing reads from `Data` yet, so the first request fills it
+	first := make(chan Event, 1)
+	go func() {
+		request := session.Request("busy.job")
+		event, _ := request.SendContext(ctx, J{"n": 1})
+		first <- event
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal("first request never reached Data")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		if len(endpoint.Data) > 0 {
+			break
+		}
+	}
+
+	request := session.Request("busy.job")
+	event, err := request.SendContext(ctx, J{"n": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remitErr RemitError
+	if !errors.As(event.Err(), &remitErr) || remitErr.Code != "data_buffer_full" {
+		t.Errorf("request with Data full: got error %v, want data_buffer_full", event.Err())
+	}
+
+	received := <-endpoint.Data
+	if received.Data["n"] != 1.0 {
+		t.Errorf("got %v from Data, want the first request", received.Data)
+	}
+	received.Success <- J{"ok": true}
+
+	event = <-first
+	if event.Err() != nil || event.Data["ok"] != true {
+		t.Errorf("first request: got data %v and error %v", event.Data, event.Err())
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	session := testSession(t)
+
+	handled := make(chan bool, 10)
+	endpoint := session.Endpoint("paused.job")
+	endpoint.OnData(func(event Event) {
+		handled <- true
+		event.Success <- nil
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = endpoint.Pause()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = session.LazyEmit("paused.job", J{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-handled:
+		t.Fatal("paused endpoint handled a message")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	for i := 0; i < 2; i++ {
+		err = endpoint.Resume()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message waiting whilst paused wasn't handled once resumed")
+	}
+
+	select {
+	case <-handled:
+		t.Error("message was handled more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDedup(t *testing.T) {
+	transport := NewMemoryTransport()
+	session := Connect(ConnectionOptions{Name: "test", Transport: transport, Logger: NopLogger{}})
+	defer session.Close(context.Background())
+
+	handled := make(chan string, 10)
+	endpoint := session.EndpointWithOptions(EndpointOptions{
+		RoutingKey: "once.job",
+		Dedup:      true,
+	})
+	endpoint.OnData(func(event Event) {
+		handled <- event.EventId
+		event.Success <- nil
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := transport.Dial("", amqp.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "a", "b"} {
+		err = channel.Publish("remit", "once.job", false, false, amqp.Publishing{
+			ContentType: "application/json",
+			MessageId:   id,
+			Body:        []byte("{}"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// give each message time to be handled and marked as seen
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	var ids []string
+	for len(handled) > 0 {
+		ids = append(ids, <-handled)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("handled messages %v, want [a b]", ids)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	session := testSession(t)
+
+	var mu sync.Mutex
+	running, most := 0, 0
+	handled := make(chan bool, 10)
+	endpoint := session.EndpointWithOptions(EndpointOptions{
+		RoutingKey:     "limited.job",
+		MaxConcurrency: 2,
+	})
+	endpoint.OnData(func(event Event) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		handled <- true
+		event.Success <- nil
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = session.LazyEmit("limited.job", J{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of 5 messages were handled", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if most != 2 {
+		t.Errorf("handled at most %d messages at once, want 2", most)
+	}
+}
@@ -1,6 +1,101 @@
 package remit
 
-import "log"
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+var (
+	// ErrPublishNacked is returned when publishing with confirms enabled and
+	// the broker refuses the message.
+	ErrPublishNacked = errors.New("remit: message was nacked by the broker")
+
+	// ErrPublishTimeout is returned when publishing with confirms enabled and
+	// the broker doesn't confirm the message in time.
+	ErrPublishTimeout = errors.New("remit: timed out waiting for the broker to confirm message")
+
+	// ErrAlreadyAcknowledged is returned when trying to ack, nack or reject a
+	// message that has already been acknowledged.
+	ErrAlreadyAcknowledged = errors.New("remit: message has already been acknowledged")
+
+	// ErrNoHandlerMatched is replied with when every handler for an endpoint
+	// passed a message on using `Event.Next` without replying to it.
+	ErrNoHandlerMatched = errors.New("remit: no handler replied to the message")
+
+	// ErrNoDeadLetterQueue is returned by `Endpoint.Redrive` if the endpoint
+	// has no `DeadLetterRoutingKey` to redrive messages from.
+	ErrNoDeadLetterQueue = errors.New("remit: endpoint has no dead-letter queue")
+
+	// ErrEndpointClosed is returned by `Endpoint.Open` if the endpoint is
+	// closed before it has started consuming.
+	ErrEndpointClosed = errors.New("remit: endpoint was closed whilst opening")
+
+	// ErrSessionClosed is returned when emitting, requesting or publishing
+	// once `Session.Close` has been called, other than from a handler it's
+	// still waiting for.
+	ErrSessionClosed = errors.New("remit: session is closing")
+
+	// ErrTxDone is returned when using a `Tx` that has already been committed
+	// or rolled back.
+	ErrTxDone = errors.New("remit: transaction has already been committed or rolled back")
+
+	// ErrPublishChannelClosed is returned by `Session.Ping` if a publish
+	// channel has closed and is yet to be reopened.
+	ErrPublishChannelClosed = errors.New("remit: publish channel is closed")
+
+	// ErrReplyQueueGone is returned by `Event.Progress` if the requester is
+	// no longer waiting for a reply.
+	ErrReplyQueueGone = errors.New("remit: reply queue no longer exists")
+
+	// ErrNoDecryptor is returned when an encrypted message is received but
+	// no `ConnectionOptions.Decryptor` has been set to decrypt it.
+	ErrNoDecryptor = errors.New("remit: received an encrypted message with no decryptor set")
+)
+
+// RemitError is the error sent back to a requester when an endpoint's handler
+// fails, available on the reply as `Event.Error` and via `Event.Err`.
+//
+// Handlers can send one to `Event.Failure` to control exactly what's replied:
+//
+// 	event.Failure <- remit.RemitError{
+// 		Code:    "not_found",
+// 		Message: "no user with that ID",
+// 		Details: remit.J{"id": id},
+// 	}
+//
+// Anything else sent to `Event.Failure` is used as the `Message`, with values
+// other than errors and strings also kept as the `Details`.
+type RemitError struct {
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func (e RemitError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+
+	return e.Code + ": " + e.Message
+}
+
+// newRemitError builds the error to reply with from whatever a handler sent
+// to `Event.Failure`.
+func newRemitError(v interface{}) RemitError {
+	switch err := v.(type) {
+	case RemitError:
+		return err
+	case *RemitError:
+		return *err
+	case error:
+		return RemitError{Message: err.Error()}
+	case string:
+		return RemitError{Message: err}
+	default:
+		return RemitError{Message: fmt.Sprint(err), Details: err}
+	}
+}
 
 func failOnError(err error, msg string) {
 	if err != nil {
@@ -1,7 +1,9 @@
 package remit
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -16,17 +18,219 @@ type Event struct {
 	EventType string      // the routing key used to route this message
 	Resource  string      // the service that send this message
 	Data      EventData   // the data this message contains (as `EventData`)
-	Error     interface{} // the error this message contains
+	Error     interface{} // the error this message contains (a `RemitError` for replies)
+	Body      []byte      // the raw, decompressed body of the message
 
 	// Channels that can be used to respond to or acknowledge this message.
 	Success chan interface{} // send data back if the handling was successful
 	Failure chan interface{} // send an error back if the handling failed
 	Next    chan bool        // skip to the next piece of middleware/function
 
-	message     amqp.Delivery
-	waitGroup   *sync.WaitGroup
-	gotResult   bool
-	workChannel chan *amqp.Channel
+	ctx             context.Context
+	message         amqp.Delivery
+	serializer      Serializer
+	acknowledgement *acknowledgement
+	replyHeaders    *replyHeaders
+	progress        func(data interface{}) error
+	redeliveries    int
+}
+
+// acknowledgement ensures a message is only ever acked, nacked or rejected once,
+// regardless of whether that's done by a handler or by Remit itself.
+type acknowledgement struct {
+	once *sync.Once
+	done chan bool
+}
+
+func newAcknowledgement(settled bool) *acknowledgement {
+	a := &acknowledgement{
+		once: &sync.Once{},
+		done: make(chan bool),
+	}
+
+	if settled {
+		a.once.Do(func() {
+			close(a.done)
+		})
+	}
+
+	return a
+}
+
+// replyHeaders collects the headers handlers want sent with the reply.
+type replyHeaders struct {
+	mu    *sync.Mutex
+	table amqp.Table
+}
+
+func newReplyHeaders() *replyHeaders {
+	return &replyHeaders{
+		mu:    &sync.Mutex{},
+		table: amqp.Table{},
+	}
+}
+
+// Ack acknowledges the message, removing it from the queue.
+//
+// This is only needed for endpoints using `EndpointOptions.ManualAck`; otherwise
+// messages are acknowledged automatically once handled.
+//
+// Only the first of `Event.Ack`, `Event.Nack` and `Event.Reject` takes effect.
+// Subsequent calls return `ErrAlreadyAcknowledged`.
+func (event Event) Ack() error {
+	return event.acknowledge(func() error {
+		return event.message.Ack(false)
+	})
+}
+
+// Nack negatively acknowledges the message. If `requeue` is `true`, the broker
+// will attempt to redeliver it, otherwise it is dropped or dead-lettered.
+func (event Event) Nack(requeue bool) error {
+	return event.acknowledge(func() error {
+		return event.message.Nack(false, requeue)
+	})
+}
+
+// Reject rejects the message. If `requeue` is `true`, the broker will attempt
+// to redeliver it, otherwise it is dropped or dead-lettered.
+func (event Event) Reject(requeue bool) error {
+	return event.acknowledge(func() error {
+		return event.message.Reject(requeue)
+	})
+}
+
+func (event Event) acknowledge(fn func() error) error {
+	if event.acknowledgement == nil {
+		return ErrAlreadyAcknowledged
+	}
+
+	err := ErrAlreadyAcknowledged
+	event.acknowledgement.once.Do(func() {
+		err = fn()
+		close(event.acknowledgement.done)
+	})
+
+	return err
+}
+
+// Context returns the context of the event, which is cancelled once the event
+// has been handled or the endpoint receiving it is closed.
+//
+// If the event wasn't received by an endpoint, `context.Background()` is returned.
+func (event Event) Context() context.Context {
+	if event.ctx == nil {
+		return context.Background()
+	}
+
+	return event.ctx
+}
+
+// Headers returns the AMQP headers the message was sent with.
+//
+// For a reply, these include any set by the responder's handlers using
+// `Event.SetReplyHeader`.
+func (event Event) Headers() amqp.Table {
+	return event.message.Headers
+}
+
+// Err returns the error the event contains as an `error`, or nil if it has
+// none. For replies, this is always a `RemitError`:
+//
+// 	event, err := request.SendContext(ctx, data)
+// 	if err != nil {
+// 		// the request couldn't be sent or no reply arrived in time
+// 	}
+//
+// 	var remitErr remit.RemitError
+// 	if errors.As(event.Err(), &remitErr) && remitErr.Code == "not_found" {
+// 		...
+// 	}
+//
+func (event Event) Err() error {
+	if event.Error == nil {
+		return nil
+	}
+
+	return newRemitError(event.Error)
+}
+
+// SetReplyHeader sets a header to be sent along with the reply to this event,
+// such as a cache hint or the version of the result's schema. The requester
+// can read it from the reply via `Event.Headers`.
+//
+// It has no effect if the event won't be replied to.
+//
+// 	event.SetReplyHeader("x-cache-ttl", 60)
+// 	event.Success <- result
+//
+func (event Event) SetReplyHeader(key string, value interface{}) {
+	if event.replyHeaders == nil {
+		return
+	}
+
+	event.replyHeaders.mu.Lock()
+	defer event.replyHeaders.mu.Unlock()
+
+	event.replyHeaders.table[key] = value
+}
+
+// progressHeader marks replies that are progress updates sent using
+// `Event.Progress` rather than the final reply.
+const progressHeader = "x-remit-progress"
+
+// Progress sends `data` to the requester as an interim update, without
+// finishing the handling of the event. The requester receives it via
+// `Request.SendWithProgress`; the final reply is still sent to `Event.Success`
+// or `Event.Failure` as usual. Updates and the final reply are published on
+// the same channel, so they're received in the order they were sent.
+//
+// It has no effect if the event won't be replied to.
+//
+// 	for i, row := range rows {
+// 		...
+// 		event.Progress(remit.J{"count": i + 1})
+// 	}
+//
+// 	event.Success <- result
+//
+func (event Event) Progress(data interface{}) error {
+	if event.progress == nil {
+		return nil
+	}
+
+	return event.progress(data)
+}
+
+// RedeliveryCount returns how many times the message has been delivered
+// before, read from the `x-delivery-count` header set by quorum queues and any
+// `x-death` headers added by dead-lettering. Retries using
+// `EndpointOptions.MaxRetries` aren't counted.
+//
+// Classic queues only flag redelivered messages without counting them, in
+// which case this is at most 1.
+func (event Event) RedeliveryCount() int {
+	return event.redeliveries
+}
+
+// CorrelationId returns the correlation ID of the message, used to match
+// requests with their replies.
+func (event Event) CorrelationId() string {
+	return event.message.CorrelationId
+}
+
+// ReplyTo returns the queue the sender expects a reply to be sent to, if any.
+func (event Event) ReplyTo() string {
+	return event.message.ReplyTo
+}
+
+// Timestamp returns the time the message was published.
+func (event Event) Timestamp() time.Time {
+	return event.message.Timestamp
+}
+
+// AppId returns the name of the service that sent the message.
+func (event Event) AppId() string {
+	return event.message.AppId
 }
 
 // EventData - for ease of use - sets `Data` within an `Event` to be a `map[string]interface{}`.
@@ -46,3 +250,20 @@ type Event struct {
 // 	bson.Unmarshal(b, &data)
 //
 type EventData map[string]interface{}
+
+// rawReplyHeader marks replies whose body is a `RawReply` rather than an
+// encoded `[err, result]` pair.
+const rawReplyHeader = "x-raw-reply"
+
+// RawReply can be sent to `Event.Success` to reply with a body exactly as given,
+// skipping the serializer entirely. The requester receives it as `Event.Body`.
+//
+// 	event.Success <- remit.RawReply{
+// 		Body:        b,
+// 		ContentType: "application/x-protobuf",
+// 	}
+//
+type RawReply struct {
+	Body        []byte
+	ContentType string
+}
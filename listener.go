@@ -0,0 +1,34 @@
+package remit
+
+// Listener is a subscription to events created by `Session.Listen`.
+//
+// Unlike an `Endpoint`, every listener consumes from its own exclusive queue,
+// so each instance of a service receives its own copy of every matching
+// message, unless grouped using `ListenOptions.Group`. Messages are always
+// acknowledged once handled and never replied to.
+type Listener struct {
+	endpoint *Endpoint
+}
+
+// ListenOptions is a list of options that can be passed when subscribing via
+// `Session.ListenWithOptions`.
+type ListenOptions struct {
+	Event string
+
+	// Group shares a single queue between every listener given the same
+	// group, so that each message is handled by only one of them, whilst other
+	// groups and ungrouped listeners still receive their own copies. The queue
+	// is deleted once every listener in the group has stopped consuming.
+	Group string
+}
+
+// Close stops the listener consuming. Its queue is deleted by RabbitMQ
+// once consumption has stopped.
+func (listener Listener) Close() {
+	listener.endpoint.Close()
+}
+
+// Queue returns the name of the queue the listener consumes from.
+func (listener Listener) Queue() string {
+	return listener.endpoint.Queue
+}
@@ -0,0 +1,129 @@
+package remit
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Logger is used by Remit to report what it's doing. Each method is given a
+// message and an optional list of alternating key/value fields:
+//
+// 	logger.Warn("Failed to parse message", "routingKey", "math.sum", "messageId", id)
+//
+// The default logger is `StdLogger`, which writes via the standard `log` package.
+// To log structured records via `log/slog`, use `SlogLogger`, and to silence
+// Remit entirely, use `NopLogger`.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// StdLogger is a `Logger` writing to the standard `log` package, with fields
+// appended as `key=value` pairs.
+//
+// Debug messages are only written if `Verbose` is set.
+type StdLogger struct {
+	Verbose bool
+}
+
+// Debug logs `msg` if `StdLogger.Verbose` is set.
+func (l StdLogger) Debug(msg string, fields ...interface{}) {
+	if l.Verbose {
+		l.print("DEBUG", msg, fields)
+	}
+}
+
+// Info logs `msg` at info level.
+func (l StdLogger) Info(msg string, fields ...interface{}) {
+	l.print("INFO", msg, fields)
+}
+
+// Warn logs `msg` at warning level.
+func (l StdLogger) Warn(msg string, fields ...interface{}) {
+	l.print("WARN", msg, fields)
+}
+
+// Error logs `msg` at error level.
+func (l StdLogger) Error(msg string, fields ...interface{}) {
+	l.print("ERROR", msg, fields)
+}
+
+func (l StdLogger) print(level string, msg string, fields []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteString(" ")
+
+		if i+1 < len(fields) {
+			fmt.Fprintf(&b, "%v=%v", fields[i], fields[i+1])
+		} else {
+			fmt.Fprintf(&b, "%v", fields[i])
+		}
+	}
+
+	log.Println(b.String())
+}
+
+// NopLogger is a `Logger` that discards everything.
+type NopLogger struct{}
+
+// Debug discards `msg`.
+func (NopLogger) Debug(msg string, fields ...interface{}) {}
+
+// Info discards `msg`.
+func (NopLogger) Info(msg string, fields ...interface{}) {}
+
+// Warn discards `msg`.
+func (NopLogger) Warn(msg string, fields ...interface{}) {}
+
+// Error discards `msg`.
+func (NopLogger) Error(msg string, fields ...interface{}) {}
+
+// SlogLogger is a `Logger` writing structured records to a `*slog.Logger`,
+// with fields passed on as attributes:
+//
+// 	remitSession := remit.Connect(remit.ConnectionOptions{
+// 		Name:   "my-service",
+// 		Url:    "amqp://localhost",
+// 		Logger: remit.SlogLogger{Logger: slog.Default()},
+// 	})
+//
+// If `Logger` is nil, `slog.Default()` is used.
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+func (l SlogLogger) logger() *slog.Logger {
+	if l.Logger == nil {
+		return slog.Default()
+	}
+
+	return l.Logger
+}
+
+// Debug logs `msg` at debug level.
+func (l SlogLogger) Debug(msg string, fields ...interface{}) {
+	l.logger().Debug(msg, fields...)
+}
+
+// Info logs `msg` at info level.
+func (l SlogLogger) Info(msg string, fields ...interface{}) {
+	l.logger().Info(msg, fields...)
+}
+
+// Warn logs `msg` at warning level.
+func (l SlogLogger) Warn(msg string, fields ...interface{}) {
+	l.logger().Warn(msg, fields...)
+}
+
+// Error logs `msg` at error level.
+func (l SlogLogger) Error(msg string, fields ...interface{}) {
+	l.logger().Error(msg, fields...)
+}
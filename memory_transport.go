@@ -0,0 +1,998 @@
+package remit
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/streadway/amqp"
+)
+
+// MemoryTransport is a `Transport` that routes messages between endpoints in
+// memory rather than through a broker, so that handlers and whole
+// request/reply round trips can be tested without RabbitMQ.
+//
+// Every session connected using the same `MemoryTransport` shares its
+// exchanges and queues:
+//
+// 	transport := remit.NewMemoryTransport()
+//
+// 	server := remit.Connect(remit.ConnectionOptions{Name: "server", Transport: transport})
+// 	client := remit.Connect(remit.ConnectionOptions{Name: "client", Transport: transport})
+//
+// Topic, direct and fanout exchanges, exchange-to-exchange bindings, exclusive
+// and auto-delete queues, acknowledgements and direct reply-to are supported.
+// Message TTLs, delays, priorities, prefetch limits and dead-lettering are
+// not, so features relying on them, such as retries, behave differently.
+type MemoryTransport struct {
+	mu        *sync.Mutex
+	exchanges map[string]*memoryExchange
+	queues    map[string]*memoryQueue
+}
+
+// NewMemoryTransport returns an empty `MemoryTransport`.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		mu:        &sync.Mutex{},
+		exchanges: make(map[string]*memoryExchange),
+		queues:    make(map[string]*memoryQueue),
+	}
+}
+
+// Dial opens a new in-memory connection. `url` and `config` are ignored.
+func (t *MemoryTransport) Dial(url string, config amqp.Config) (Connection, error) {
+	return &memoryConnection{
+		transport: t,
+		mu:        &sync.Mutex{},
+	}, nil
+}
+
+type memoryExchange struct {
+	kind     string
+	bindings []memoryBinding
+}
+
+// memoryBinding routes messages with a matching key to either a queue or
+// another exchange.
+type memoryBinding struct {
+	key      string
+	queue    string
+	exchange string
+}
+
+// route finds every queue a message published to `exchange` with `key`
+// should be delivered to. `t.mu` must be held.
+func (t *MemoryTransport) route(exchange string, key string, seen map[string]bool) ([]*memoryQueue, error) {
+	if exchange == "" {
+		queue, ok := t.queues[key]
+		if !ok {
+			return nil, nil
+		}
+
+		return []*memoryQueue{queue}, nil
+	}
+
+	ex, ok := t.exchanges[exchange]
+	if !ok {
+		return nil, &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange '" + exchange + "'"}
+	}
+
+	// guard against exchanges bound to each other in a loop
+	if seen[exchange] {
+		return nil, nil
+	}
+	seen[exchange] = true
+
+	queues := []*memoryQueue{}
+	for _, binding := range ex.bindings {
+		if !ex.matches(binding.key, key) {
+			continue
+		}
+
+		if binding.queue != "" {
+			if queue, ok := t.queues[binding.queue]; ok {
+				queues = append(queues, queue)
+			}
+			continue
+		}
+
+		routed, err := t.route(binding.exchange, key, seen)
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, routed...)
+	}
+
+	return queues, nil
+}
+
+func (ex *memoryExchange) matches(pattern string, key string) bool {
+	switch ex.kind {
+	case "fanout":
+		return true
+	case "direct":
+		return pattern == key
+	default:
+		return topicMatches(strings.Split(pattern, "."), strings.Split(key, "."))
+	}
+}
+
+// topicMatches reports whether the words of a routing key match those of a
+// topic binding, where `*` matches exactly one word and `#` zero or more.
+func topicMatches(pattern []string, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	if pattern[0] == "#" {
+		for i := 0; i <= len(key); i++ {
+			if topicMatches(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(key) == 0 || (pattern[0] != "*" && pattern[0] != key[0]) {
+		return false
+	}
+
+	return topicMatches(pattern[1:], key[1:])
+}
+
+type memoryMessage struct {
+	exchange    string
+	key         string
+	publishing  amqp.Publishing
+	mandatory   bool
+	redelivered bool
+}
+
+type memoryQueue struct {
+	name       string
+	owner      *memoryConnection
+	autoDelete bool
+
+	mu        *sync.Mutex
+	cond      *sync.Cond
+	messages  []memoryMessage
+	consumers []*memoryConsumer
+	next      int
+	deleted   bool
+}
+
+func newMemoryQueue(name string, owner *memoryConnection, autoDelete bool) *memoryQueue {
+	q := &memoryQueue{
+		name:       name,
+		owner:      owner,
+		autoDelete: autoDelete,
+		mu:         &sync.Mutex{},
+	}
+	q.cond = sync.NewCond(q.mu)
+
+	go q.run()
+
+	return q
+}
+
+func (q *memoryQueue) push(message memoryMessage, front bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if front {
+		q.messages = append([]memoryMessage{message}, q.messages...)
+	} else {
+		q.messages = append(q.messages, message)
+	}
+
+	q.cond.Signal()
+}
+
+// run hands each message to the queue's consumers in turn.
+func (q *memoryQueue) run() {
+	for {
+		q.mu.Lock()
+		for !q.deleted && (len(q.messages) == 0 || len(q.consumers) == 0) {
+			q.cond.Wait()
+		}
+
+		if q.deleted {
+			q.mu.Unlock()
+			return
+		}
+
+		message := q.messages[0]
+		q.messages = q.messages[1:]
+		q.next = (q.next + 1) % len(q.consumers)
+		consumer := q.consumers[q.next]
+		q.mu.Unlock()
+
+		if !consumer.deliver(q, message) {
+			q.push(message, true)
+		}
+	}
+}
+
+// pop takes the next message off the queue, if there is one.
+func (q *memoryQueue) pop() (memoryMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.messages) == 0 {
+		return memoryMessage{}, false
+	}
+
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+
+	return message, true
+}
+
+func (q *memoryQueue) addConsumer(consumer *memoryConsumer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.consumers = append(q.consumers, consumer)
+	q.cond.Signal()
+}
+
+// removeConsumer returns whether the queue should now be auto-deleted.
+func (q *memoryQueue) removeConsumer(consumer *memoryConsumer) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, c := range q.consumers {
+		if c == consumer {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+
+	return q.autoDelete && len(q.consumers) == 0
+}
+
+func (q *memoryQueue) delete() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deleted = true
+	q.cond.Broadcast()
+}
+
+type memoryConsumer struct {
+	tag        string
+	channel    *memoryChannel
+	queue      *memoryQueue
+	autoAck    bool
+	deliveries chan amqp.Delivery
+
+	mu        *sync.Mutex
+	done      chan bool
+	cancelled bool
+}
+
+// deliver passes a message on to the consumer, returning false if it was
+// cancelled first.
+func (c *memoryConsumer) deliver(q *memoryQueue, message memoryMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancelled {
+		return false
+	}
+
+	tag := c.channel.track(q, message, c.autoAck)
+	delivery := c.channel.delivery(message, tag, c.tag)
+
+	select {
+	case c.deliveries <- delivery:
+		return true
+	case <-c.done:
+		c.channel.untrack(tag)
+		return false
+	}
+}
+
+// delivery converts a message in to the delivery a consumer receives.
+func (ch *memoryChannel) delivery(message memoryMessage, tag uint64, consumerTag string) amqp.Delivery {
+	p := message.publishing
+
+	return amqp.Delivery{
+		Acknowledger:    ch,
+		Headers:         p.Headers,
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		DeliveryMode:    p.DeliveryMode,
+		Priority:        p.Priority,
+		CorrelationId:   p.CorrelationId,
+		ReplyTo:         p.ReplyTo,
+		Expiration:      p.Expiration,
+		MessageId:       p.MessageId,
+		Timestamp:       p.Timestamp,
+		Type:            p.Type,
+		UserId:          p.UserId,
+		AppId:           p.AppId,
+		ConsumerTag:     consumerTag,
+		DeliveryTag:     tag,
+		Redelivered:     message.redelivered,
+		Exchange:        message.exchange,
+		RoutingKey:      message.key,
+		Body:            p.Body,
+	}
+}
+
+func (c *memoryConsumer) cancel() {
+	close(c.done)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cancelled = true
+	close(c.deliveries)
+}
+
+type memoryConnection struct {
+	transport *MemoryTransport
+
+	mu       *sync.Mutex
+	channels []*memoryChannel
+	closers  []chan *amqp.Error
+	closed   bool
+}
+
+func (conn *memoryConnection) Channel() (Channel, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	channel := &memoryChannel{
+		conn:      conn,
+		mu:        &sync.Mutex{},
+		consumers: make(map[string]*memoryConsumer),
+		unacked:   make(map[uint64]memoryUnacked),
+	}
+	conn.channels = append(conn.channels, channel)
+
+	return channel, nil
+}
+
+func (conn *memoryConnection) Close() error {
+	conn.mu.Lock()
+	if conn.closed {
+		conn.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	conn.closed = true
+	channels := conn.channels
+	closers := conn.closers
+	conn.mu.Unlock()
+
+	for _, channel := range channels {
+		channel.Close()
+	}
+
+	t := conn.transport
+	t.mu.Lock()
+	for name, queue := range t.queues {
+		if queue.owner == conn {
+			delete(t.queues, name)
+			queue.delete()
+		}
+	}
+	t.mu.Unlock()
+
+	for _, c := range closers {
+		close(c)
+	}
+
+	return nil
+}
+
+func (conn *memoryConnection) IsClosed() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return conn.closed
+}
+
+func (conn *memoryConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.closed {
+		close(receiver)
+	} else {
+		conn.closers = append(conn.closers, receiver)
+	}
+
+	return receiver
+}
+
+type memoryUnacked struct {
+	queue   *memoryQueue
+	message memoryMessage
+}
+
+type memoryChannel struct {
+	conn *memoryConnection
+
+	mu         *sync.Mutex
+	consumers  map[string]*memoryConsumer
+	unacked    map[uint64]memoryUnacked
+	tag        uint64
+	replyQueue string
+	confirm    bool
+	tx         bool
+	pending    []memoryMessage
+	published  uint64
+	confirms   []chan amqp.Confirmation
+	returns    []chan amqp.Return
+	closers    []chan *amqp.Error
+	cancels    []chan string
+	closed     bool
+}
+
+func (ch *memoryChannel) track(q *memoryQueue, message memoryMessage, autoAck bool) uint64 {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	ch.tag++
+	if !autoAck {
+		ch.unacked[ch.tag] = memoryUnacked{queue: q, message: message}
+	}
+
+	return ch.tag
+}
+
+func (ch *memoryChannel) untrack(tag uint64) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	delete(ch.unacked, tag)
+}
+
+// settle removes an unacknowledged message, returning it to its queue if
+// `requeue` is set.
+func (ch *memoryChannel) settle(tag uint64, requeue bool) error {
+	ch.mu.Lock()
+	unacked, ok := ch.unacked[tag]
+	delete(ch.unacked, tag)
+	closed := ch.closed
+	ch.mu.Unlock()
+
+	if closed {
+		return amqp.ErrClosed
+	}
+
+	if !ok {
+		return &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - unknown delivery tag"}
+	}
+
+	if requeue {
+		unacked.message.redelivered = true
+		unacked.queue.push(unacked.message, true)
+	}
+
+	return nil
+}
+
+// Ack, Nack and Reject make the channel an `amqp.Acknowledger` for the
+// deliveries it hands out.
+func (ch *memoryChannel) Ack(tag uint64, multiple bool) error {
+	return ch.settle(tag, false)
+}
+
+func (ch *memoryChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return ch.settle(tag, requeue)
+}
+
+func (ch *memoryChannel) Reject(tag uint64, requeue bool) error {
+	return ch.settle(tag, requeue)
+}
+
+func (ch *memoryChannel) check() error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	ch.mu.Lock()
+	if msg.ReplyTo == "amq.rabbitmq.reply-to" {
+		msg.ReplyTo = ch.replyQueue
+	}
+	ch.mu.Unlock()
+
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	message := memoryMessage{exchange: exchange, key: key, publishing: msg, mandatory: mandatory}
+
+	ch.mu.Lock()
+	if ch.tx {
+		ch.pending = append(ch.pending, message)
+		ch.mu.Unlock()
+		return nil
+	}
+	ch.mu.Unlock()
+
+	err = ch.publish(message)
+	if err != nil {
+		return err
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.confirm {
+		ch.published++
+		for _, c := range ch.confirms {
+			c <- amqp.Confirmation{DeliveryTag: ch.published, Ack: true}
+		}
+	}
+
+	return nil
+}
+
+// publish routes a message to its queues, returning it to the channel's
+// `NotifyReturn` listeners if it's mandatory and there are none.
+func (ch *memoryChannel) publish(message memoryMessage) error {
+	t := ch.conn.transport
+	t.mu.Lock()
+	queues, err := t.route(message.exchange, message.key, map[string]bool{})
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, queue := range queues {
+		queue.push(message, false)
+	}
+
+	if len(queues) > 0 || !message.mandatory {
+		return nil
+	}
+
+	ch.mu.Lock()
+	returns := ch.returns
+	ch.mu.Unlock()
+
+	p := message.publishing
+	for _, c := range returns {
+		c <- amqp.Return{
+			ReplyCode:       amqp.NoRoute,
+			ReplyText:       "NO_ROUTE",
+			Exchange:        message.exchange,
+			RoutingKey:      message.key,
+			Headers:         p.Headers,
+			ContentType:     p.ContentType,
+			ContentEncoding: p.ContentEncoding,
+			DeliveryMode:    p.DeliveryMode,
+			Priority:        p.Priority,
+			CorrelationId:   p.CorrelationId,
+			ReplyTo:         p.ReplyTo,
+			Expiration:      p.Expiration,
+			MessageId:       p.MessageId,
+			Timestamp:       p.Timestamp,
+			Type:            p.Type,
+			UserId:          p.UserId,
+			AppId:           p.AppId,
+			Body:            p.Body,
+		}
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	err := ch.check()
+	if err != nil {
+		return nil, err
+	}
+
+	t := ch.conn.transport
+
+	// direct reply-to gets a private queue that replies are routed to
+	if queue == "amq.rabbitmq.reply-to" {
+		queue = "amq.rabbitmq.reply-to." + ulid.MustNew(ulid.Now(), nil).String()
+
+		t.mu.Lock()
+		t.queues[queue] = newMemoryQueue(queue, ch.conn, true)
+		t.mu.Unlock()
+
+		ch.mu.Lock()
+		ch.replyQueue = queue
+		ch.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	q, ok := t.queues[queue]
+	t.mu.Unlock()
+	if !ok {
+		return nil, &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no queue '" + queue + "'"}
+	}
+
+	if consumer == "" {
+		consumer = ulid.MustNew(ulid.Now(), nil).String()
+	}
+
+	c := &memoryConsumer{
+		tag:        consumer,
+		channel:    ch,
+		queue:      q,
+		autoAck:    autoAck,
+		deliveries: make(chan amqp.Delivery),
+		mu:         &sync.Mutex{},
+		done:       make(chan bool),
+	}
+
+	ch.mu.Lock()
+	ch.consumers[consumer] = c
+	ch.mu.Unlock()
+
+	q.addConsumer(c)
+
+	return c.deliveries, nil
+}
+
+func (ch *memoryChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	err := ch.check()
+	if err != nil {
+		return amqp.Delivery{}, false, err
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	q, ok := t.queues[queue]
+	t.mu.Unlock()
+	if !ok {
+		return amqp.Delivery{}, false, &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no queue '" + queue + "'"}
+	}
+
+	message, ok := q.pop()
+	if !ok {
+		return amqp.Delivery{}, false, nil
+	}
+
+	tag := ch.track(q, message, autoAck)
+
+	return ch.delivery(message, tag, ""), true, nil
+}
+
+func (ch *memoryChannel) Cancel(consumer string, noWait bool) error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	ch.mu.Lock()
+	c, ok := ch.consumers[consumer]
+	delete(ch.consumers, consumer)
+	ch.mu.Unlock()
+
+	if ok {
+		ch.removeConsumer(c)
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) removeConsumer(c *memoryConsumer) {
+	c.cancel()
+
+	if !c.queue.removeConsumer(c) {
+		return
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	if t.queues[c.queue.name] == c.queue {
+		delete(t.queues, c.queue.name)
+	}
+	t.mu.Unlock()
+	c.queue.delete()
+}
+
+func (ch *memoryChannel) Close() error {
+	ch.mu.Lock()
+	if ch.closed {
+		ch.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	ch.closed = true
+	consumers := ch.consumers
+	unacked := ch.unacked
+	ch.consumers = make(map[string]*memoryConsumer)
+	ch.unacked = make(map[uint64]memoryUnacked)
+	ch.mu.Unlock()
+
+	for _, c := range consumers {
+		ch.removeConsumer(c)
+	}
+
+	// anything left unacknowledged goes back on its queue
+	for _, u := range unacked {
+		u.message.redelivered = true
+		u.queue.push(u.message, true)
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, c := range ch.closers {
+		close(c)
+	}
+	for _, c := range ch.cancels {
+		close(c)
+	}
+	for _, c := range ch.confirms {
+		close(c)
+	}
+	for _, c := range ch.returns {
+		close(c)
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return ch.check()
+}
+
+func (ch *memoryChannel) Confirm(noWait bool) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+
+	ch.confirm = true
+
+	return nil
+}
+
+func (ch *memoryChannel) Tx() error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	ch.tx = true
+
+	return nil
+}
+
+// TxCommit routes every message published since the last commit or rollback.
+func (ch *memoryChannel) TxCommit() error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	ch.mu.Lock()
+	pending := ch.pending
+	ch.pending = nil
+	ch.mu.Unlock()
+
+	for _, message := range pending {
+		err = ch.publish(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) TxRollback() error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	ch.pending = nil
+
+	return nil
+}
+
+func (ch *memoryChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	err := ch.check()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+
+	if name == "" {
+		name = "amq.gen-" + ulid.MustNew(ulid.Now(), nil).String()
+	}
+
+	var owner *memoryConnection
+	if exclusive {
+		owner = ch.conn
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	q, ok := t.queues[name]
+	if !ok {
+		q = newMemoryQueue(name, owner, autoDelete)
+		t.queues[name] = q
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return amqp.Queue{Name: name, Messages: len(q.messages), Consumers: len(q.consumers)}, nil
+}
+
+func (ch *memoryChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	err := ch.check()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	q, ok := t.queues[name]
+	if !ok {
+		return amqp.Queue{}, &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no queue '" + name + "'"}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return amqp.Queue{Name: name, Messages: len(q.messages), Consumers: len(q.consumers)}, nil
+}
+
+func (ch *memoryChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return ch.bind(exchange, memoryBinding{key: key, queue: name})
+}
+
+func (ch *memoryChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	// delayed exchanges route like the type they wrap, just without the delay
+	if kind == "x-delayed-message" {
+		if delayedType, ok := args["x-delayed-type"].(string); ok {
+			kind = delayedType
+		}
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.exchanges[name]; !ok {
+		t.exchanges[name] = &memoryExchange{kind: kind}
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.exchanges[name]; !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange '" + name + "'"}
+	}
+
+	return nil
+}
+
+func (ch *memoryChannel) ExchangeBind(destination, key, source string, noWait bool, args amqp.Table) error {
+	return ch.bind(source, memoryBinding{key: key, exchange: destination})
+}
+
+func (ch *memoryChannel) bind(exchange string, binding memoryBinding) error {
+	err := ch.check()
+	if err != nil {
+		return err
+	}
+
+	t := ch.conn.transport
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ex, ok := t.exchanges[exchange]
+	if !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no exchange '" + exchange + "'"}
+	}
+
+	for _, existing := range ex.bindings {
+		if existing == binding {
+			return nil
+		}
+	}
+
+	ex.bindings = append(ex.bindings, binding)
+
+	return nil
+}
+
+func (ch *memoryChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		close(confirm)
+	} else {
+		ch.confirms = append(ch.confirms, confirm)
+	}
+
+	return confirm
+}
+
+func (ch *memoryChannel) NotifyReturn(returns chan amqp.Return) chan amqp.Return {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		close(returns)
+	} else {
+		ch.returns = append(ch.returns, returns)
+	}
+
+	return returns
+}
+
+func (ch *memoryChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		close(receiver)
+	} else {
+		ch.closers = append(ch.closers, receiver)
+	}
+
+	return receiver
+}
+
+func (ch *memoryChannel) NotifyCancel(receiver chan string) chan string {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		close(receiver)
+	} else {
+		ch.cancels = append(ch.cancels, receiver)
+	}
+
+	return receiver
+}
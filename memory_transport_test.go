@@ -0,0 +1,263 @@
+package remit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"user.created", "user.created", true},
+		{"user.created", "user.deleted", false},
+		{"user.*", "user.created", true},
+		{"user.*", "user", false},
+		{"user.*", "user.created.v2", false},
+		{"*.created", "user.created", true},
+		{"user.#", "user", true},
+		{"user.#", "user.created", true},
+		{"user.#", "user.created.v2", true},
+		{"#", "user.created", true},
+		{"#.v2", "user.created.v2", true},
+		{"#.v2", "user.created.v1", false},
+		{"user.#.v2", "user.v2", true},
+		{"user.*.v2", "user.v2", false},
+	}
+
+	for _, test := range tests {
+		got := topicMatches(strings.Split(test.pattern, "."), strings.Split(test.key, "."))
+		if got != test.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", test.pattern, test.key, got, test.want)
+		}
+	}
+}
+
+// testChannel opens a channel on a fresh `MemoryTransport`, with a "q"
+// queue bound to a "remit" exchange of type `kind` using `binding`.
+func testChannel(t *testing.T, kind string, binding string) Channel {
+	t.Helper()
+
+	conn, err := NewMemoryTransport().Dial("", amqp.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	err = channel.ExchangeDeclare("remit", kind, true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = channel.QueueDeclare("q", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = channel.QueueBind("q", binding, "remit", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return channel
+}
+
+// receive waits briefly for a message on `deliveries`, returning false if
+// none arrives.
+func receive(deliveries <-chan amqp.Delivery) (amqp.Delivery, bool) {
+	select {
+	case d := <-deliveries:
+		return d, true
+	case <-time.After(100 * time.Millisecond):
+		return amqp.Delivery{}, false
+	}
+}
+
+func TestMemoryTransportRouting(t *testing.T) {
+	tests := []struct {
+		kind    string
+		binding string
+		key     string
+		routed  bool
+	}{
+		{"topic", "user.*", "user.created", true},
+		{"topic", "user.*", "order.created", false},
+		{"direct", "user.created", "user.created", true},
+		{"direct", "user.*", "user.created", false},
+		{"fanout", "", "anything", true},
+	}
+
+	for _, test := range tests {
+		channel := testChannel(t, test.kind, test.binding)
+
+		deliveries, err := channel.Consume("q", "", true, false, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = channel.Publish("remit", test.key, false, false, amqp.Publishing{
+			MessageId: "1",
+			Body:      []byte(test.key),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, ok := receive(deliveries)
+		if ok != test.routed {
+			t.Errorf("%s %q with key %q: routed = %v, want %v", test.kind, test.binding, test.key, ok, test.routed)
+			continue
+		}
+
+		if ok && (string(d.Body) != test.key || d.RoutingKey != test.key || d.Exchange != "remit") {
+			t.Errorf("%s %q: got body %q, routing key %q and exchange %q", test.kind, test.binding, d.Body, d.RoutingKey, d.Exchange)
+		}
+	}
+}
+
+func TestMemoryTransportSettle(t *testing.T) {
+	tests := []struct {
+		name        string
+		settle      func(d amqp.Delivery) error
+		redelivered bool
+	}{
+		{"ack", func(d amqp.Delivery) error { return d.Ack(false) }, false},
+		{"nack", func(d amqp.Delivery) error { return d.Nack(false, false) }, false},
+		{"nack and requeue", func(d amqp.Delivery) error { return d.Nack(false, true) }, true},
+		{"reject", func(d amqp.Delivery) error { return d.Reject(false) }, false},
+		{"reject and requeue", func(d amqp.Delivery) error { return d.Reject(true) }, true},
+	}
+
+	for _, test := range tests {
+		channel := testChannel(t, "topic", "#")
+
+		deliveries, err := channel.Consume("q", "", false, false, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = channel.Publish("remit", "key", false, false, amqp.Publishing{Body: []byte("body")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, ok := receive(deliveries)
+		if !ok {
+			t.Fatalf("%s: message wasn't delivered", test.name)
+		}
+		if d.Redelivered {
+			t.Errorf("%s: first delivery flagged as redelivered", test.name)
+		}
+
+		err = test.settle(d)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		d, ok = receive(deliveries)
+		if ok != test.redelivered {
+			t.Errorf("%s: requeued = %v, want %v", test.name, ok, test.redelivered)
+		}
+		if ok && !d.Redelivered {
+			t.Errorf("%s: requeued message not flagged as redelivered", test.name)
+		}
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	session := Connect(ConnectionOptions{Name: "test", Transport: transport, Logger: NopLogger{}})
+
+	_, err := session.LazyEndpoint("math.sum", func(event Event) {
+		sum := 0.0
+		for _, n := range event.Data["numbers"].([]interface{}) {
+			sum += n.(float64)
+		}
+
+		event.Success <- J{"sum": sum}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = session.LazyEndpoint("math.fail", func(event Event) {
+		event.Failure <- RemitError{Code: "bad_input", Message: "no"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key     string
+		data    interface{}
+		wantSum float64
+		wantErr bool
+	}{
+		{"math.sum", J{"numbers": []int{1, 5, 7}}, 13, false},
+		{"math.sum", J{"numbers": []int{}}, 0, false},
+		{"math.fail", nil, 0, true},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		request := session.Request(test.key)
+		event, err := request.SendContext(ctx, test.data)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: %v", test.key, err)
+		}
+
+		if (event.Err() != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error = %v", test.key, event.Err(), test.wantErr)
+		}
+		if !test.wantErr && event.Data["sum"] != test.wantSum {
+			t.Errorf("%s: got sum %v, want %v", test.key, event.Data["sum"], test.wantSum)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = session.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryTransportClosedChannel(t *testing.T) {
+	channel := testChannel(t, "topic", "#")
+
+	err := channel.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = channel.Confirm(false)
+	if err != amqp.ErrClosed {
+		t.Errorf("Confirm: got %v, want %v", err, amqp.ErrClosed)
+	}
+
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	_, ok := <-confirms
+	if ok {
+		t.Error("NotifyPublish: receiver wasn't closed")
+	}
+
+	returns := channel.NotifyReturn(make(chan amqp.Return, 1))
+	_, ok = <-returns
+	if ok {
+		t.Error("NotifyReturn: receiver wasn't closed")
+	}
+}
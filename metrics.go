@@ -0,0 +1,48 @@
+package remit
+
+import "time"
+
+// Metrics receives callbacks as messages flow through Remit, so that counters,
+// histograms and the like can be recorded with any metrics system. Each is
+// given the queue of the endpoint involved and the message's routing key.
+//
+// The default is `NopMetrics`, which records nothing. For Prometheus, see the
+// `metrics` package.
+type Metrics interface {
+	// MessageReceived is called whenever an endpoint receives a message.
+	MessageReceived(queue string, routingKey string)
+
+	// MessageRedelivered is called along with `MessageReceived` for messages
+	// that have been delivered before, as given by `Event.RedeliveryCount`.
+	MessageRedelivered(queue string, routingKey string)
+
+	// MessageProcessed is called once an endpoint's handlers have finished
+	// with a message, with how long they took and the error they failed
+	// with, if any.
+	MessageProcessed(queue string, routingKey string, d time.Duration, err error)
+
+	// ReplyPublished is called whenever an endpoint publishes a reply.
+	ReplyPublished(queue string, routingKey string)
+
+	// ReconnectOccurred is called whenever the connection or an endpoint's
+	// channel is re-established after being lost.
+	ReconnectOccurred()
+}
+
+// NopMetrics is a `Metrics` implementation that records nothing.
+type NopMetrics struct{}
+
+// MessageReceived does nothing.
+func (NopMetrics) MessageReceived(queue string, routingKey string) {}
+
+// MessageRedelivered does nothing.
+func (NopMetrics) MessageRedelivered(queue string, routingKey string) {}
+
+// MessageProcessed does nothing.
+func (NopMetrics) MessageProcessed(queue string, routingKey string, d time.Duration, err error) {}
+
+// ReplyPublished does nothing.
+func (NopMetrics) ReplyPublished(queue string, routingKey string) {}
+
+// ReconnectOccurred does nothing.
+func (NopMetrics) ReconnectOccurred() {}
@@ -0,0 +1,142 @@
+// Package metrics records Remit's `Metrics` callbacks using Prometheus.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the histogram
+// buckets `Prometheus` sorts handler durations in to.
+var DefaultDurationBuckets = prometheus.DefBuckets
+
+// Prometheus is a `remit.Metrics` implementation that keeps counts of
+// messages received, redelivered, processed and replied to, and a histogram
+// of how long handlers took, labelled by queue and routing key.
+//
+// It's a `prometheus.Collector`, so is registered with whichever registry
+// the service already serves, such as using `promhttp`:
+//
+// 	collector := metrics.NewPrometheus()
+// 	prometheus.MustRegister(collector)
+//
+// 	remitSession := remit.Connect(remit.ConnectionOptions{
+// 		Name:    "my-service",
+// 		Url:     "amqp://localhost",
+// 		Metrics: collector,
+// 	})
+//
+// 	http.Handle("/metrics", promhttp.Handler())
+//
+// The following metrics are exposed:
+//
+// 	remit_messages_received_total{queue, routing_key}
+// 	remit_messages_redelivered_total{queue, routing_key}
+// 	remit_messages_processed_total{queue, routing_key, result="success|error"}
+// 	remit_handler_duration_seconds{queue, routing_key}
+// 	remit_replies_published_total{queue, routing_key}
+// 	remit_reconnects_total
+//
+type Prometheus struct {
+	received    *prometheus.CounterVec
+	redelivered *prometheus.CounterVec
+	processed   *prometheus.CounterVec
+	durations   *prometheus.HistogramVec
+	replies     *prometheus.CounterVec
+	reconnects  prometheus.Counter
+}
+
+// NewPrometheus returns a `Prometheus` using `DefaultDurationBuckets`.
+func NewPrometheus() *Prometheus {
+	return NewPrometheusWithBuckets(DefaultDurationBuckets)
+}
+
+// NewPrometheusWithBuckets returns a `Prometheus` sorting handler durations
+// in to histogram buckets with the given upper bounds, in seconds.
+func NewPrometheusWithBuckets(buckets []float64) *Prometheus {
+	labels := []string{"queue", "routing_key"}
+
+	return &Prometheus{
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "remit_messages_received_total",
+			Help: "Messages received by endpoints.",
+		}, labels),
+		redelivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "remit_messages_redelivered_total",
+			Help: "Messages received by endpoints that had been delivered before.",
+		}, labels),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "remit_messages_processed_total",
+			Help: "Messages handled by endpoints, by result.",
+		}, []string{"queue", "routing_key", "result"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "remit_handler_duration_seconds",
+			Help:    "How long endpoints took to handle messages.",
+			Buckets: buckets,
+		}, labels),
+		replies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "remit_replies_published_total",
+			Help: "Replies published by endpoints.",
+		}, labels),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "remit_reconnects_total",
+			Help: "Times the connection or an endpoint's channel has been re-established.",
+		}),
+	}
+}
+
+// MessageReceived counts a message received from `queue` with `routingKey`.
+func (m *Prometheus) MessageReceived(queue string, routingKey string) {
+	m.received.WithLabelValues(queue, routingKey).Inc()
+}
+
+// MessageRedelivered counts a message received from `queue` that had been
+// delivered before.
+func (m *Prometheus) MessageRedelivered(queue string, routingKey string) {
+	m.redelivered.WithLabelValues(queue, routingKey).Inc()
+}
+
+// MessageProcessed counts a handled message by whether it failed and records
+// how long it took.
+func (m *Prometheus) MessageProcessed(queue string, routingKey string, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.processed.WithLabelValues(queue, routingKey, result).Inc()
+	m.durations.WithLabelValues(queue, routingKey).Observe(d.Seconds())
+}
+
+// ReplyPublished counts a reply sent for a message received from `queue`
+// with `routingKey`.
+func (m *Prometheus) ReplyPublished(queue string, routingKey string) {
+	m.replies.WithLabelValues(queue, routingKey).Inc()
+}
+
+// ReconnectOccurred counts the connection or an endpoint's channel being
+// re-established.
+func (m *Prometheus) ReconnectOccurred() {
+	m.reconnects.Inc()
+}
+
+// Describe sends the descriptions of every metric to `ch`.
+func (m *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	m.received.Describe(ch)
+	m.redelivered.Describe(ch)
+	m.processed.Describe(ch)
+	m.durations.Describe(ch)
+	m.replies.Describe(ch)
+	m.reconnects.Describe(ch)
+}
+
+// Collect sends the current value of every metric to `ch`.
+func (m *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	m.received.Collect(ch)
+	m.redelivered.Collect(ch)
+	m.processed.Collect(ch)
+	m.durations.Collect(ch)
+	m.replies.Collect(ch)
+	m.reconnects.Collect(ch)
+}
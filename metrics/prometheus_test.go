@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	remit "github.com/jpwilliams/go-remit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ remit.Metrics = &Prometheus{}
+
+func TestPrometheus(t *testing.T) {
+	m := NewPrometheusWithBuckets([]float64{0.1, 1})
+
+	m.MessageReceived("math.sum", "math.sum")
+	m.MessageReceived("math.sum", "math.sum")
+	m.MessageReceived("users", "user.created")
+	m.MessageRedelivered("math.sum", "math.sum")
+	m.MessageProcessed("math.sum", "math.sum", 50*time.Millisecond, nil)
+	m.MessageProcessed("math.sum", "math.sum", 500*time.Millisecond, errors.New("failed"))
+	m.ReplyPublished("math.sum", "math.sum")
+	m.ReconnectOccurred()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"remit_messages_received_total", `
+# HELP remit_messages_received_total Messages received by endpoints.
+# TYPE remit_messages_received_total counter
+remit_messages_received_total{queue="math.sum",routing_key="math.sum"} 2
+remit_messages_received_total{queue="users",routing_key="user.created"} 1
+`},
+		{"remit_messages_redelivered_total", `
+# HELP remit_messages_redelivered_total Messages received by endpoints that had been delivered before.
+# TYPE remit_messages_redelivered_total counter
+remit_messages_redelivered_total{queue="math.sum",routing_key="math.sum"} 1
+`},
+		{"remit_messages_processed_total", `
+# HELP remit_messages_processed_total Messages handled by endpoints, by result.
+# TYPE remit_messages_processed_total counter
+remit_messages_processed_total{queue="math.sum",result="error",routing_key="math.sum"} 1
+remit_messages_processed_total{queue="math.sum",result="success",routing_key="math.sum"} 1
+`},
+		{"remit_handler_duration_seconds", `
+# HELP remit_handler_duration_seconds How long endpoints took to handle messages.
+# TYPE remit_handler_duration_seconds histogram
+remit_handler_duration_seconds_bucket{queue="math.sum",routing_key="math.sum",le="0.1"} 1
+remit_handler_duration_seconds_bucket{queue="math.sum",routing_key="math.sum",le="1"} 2
+remit_handler_duration_seconds_bucket{queue="math.sum",routing_key="math.sum",le="+Inf"} 2
+remit_handler_duration_seconds_sum{queue="math.sum",routing_key="math.sum"} 0.55
+remit_handler_duration_seconds_count{queue="math.sum",routing_key="math.sum"} 2
+`},
+		{"remit_replies_published_total", `
+# HELP remit_replies_published_total Replies published by endpoints.
+# TYPE remit_replies_published_total counter
+remit_replies_published_total{queue="math.sum",routing_key="math.sum"} 1
+`},
+		{"remit_reconnects_total", `
+# HELP remit_reconnects_total Times the connection or an endpoint's channel has been re-established.
+# TYPE remit_reconnects_total counter
+remit_reconnects_total 1
+`},
+	}
+
+	for _, test := range tests {
+		err := testutil.CollectAndCompare(m, strings.NewReader(test.want), test.name)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+func TestPrometheusRegisters(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+
+	err := registry.Register(NewPrometheus())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = registry.Register(NewPrometheus())
+	if err == nil {
+		t.Error("registered the same metrics twice without an error")
+	}
+}
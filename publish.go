@@ -0,0 +1,59 @@
+package remit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// PublishOptions is a list of options that can be passed when publishing a
+// message via `Session.Publish`.
+type PublishOptions struct {
+	// Headers are sent along with the message as AMQP headers.
+	Headers amqp.Table
+
+	// ContentType overrides the content type given by the session's
+	// `Serializer`. If the data being published is a `[]byte`, it is sent
+	// as-is instead of being serialized.
+	ContentType string
+
+	// Persistent asks the broker to write the message to disk, so that it
+	// survives a broker restart if routed to a durable queue.
+	Persistent bool
+
+	// Expiration is how long the message can wait in a queue before being
+	// dropped or dead-lettered. Zero, the default, means it never expires.
+	Expiration time.Duration
+
+	// Priority is the priority of the message, used by queues declared with
+	// `EndpointOptions.MaxPriority` or `"x-max-priority"`.
+	Priority uint8
+}
+
+// PublishInterceptor is run for every message Remit publishes, including
+// requests, replies and emissions, just before it's sent. It can modify the
+// message, such as to add headers, but must not keep hold of it.
+type PublishInterceptor func(exchange string, key string, message *amqp.Publishing)
+
+// intercept runs each of `interceptors` on a message about to be published.
+func intercept(interceptors []PublishInterceptor, exchange string, key string, message *amqp.Publishing) {
+	if message.Headers == nil && len(interceptors) > 0 {
+		message.Headers = amqp.Table{}
+	}
+
+	for _, interceptor := range interceptors {
+		interceptor(exchange, key, message)
+	}
+}
+
+// expiration formats `ttl` as the millisecond string AMQP expects. Durations
+// under a millisecond are rounded up, so that the message still expires.
+func expiration(ttl time.Duration) string {
+	ms := ttl / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+
+	return strconv.FormatInt(int64(ms), 10)
+}
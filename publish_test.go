@@ -0,0 +1,79 @@
+package remit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestExpiration(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{time.Second, "1000"},
+		{1500 * time.Millisecond, "1500"},
+		{time.Minute, "60000"},
+		{time.Millisecond, "1"},
+		{time.Microsecond, "1"},
+		{0, "1"},
+	}
+
+	for _, test := range tests {
+		got := expiration(test.ttl)
+		if got != test.want {
+			t.Errorf("expiration(%v) = %q, want %q", test.ttl, got, test.want)
+		}
+	}
+}
+
+func TestPublishUnencoded(t *testing.T) {
+	transport := NewMemoryTransport()
+	session := Connect(ConnectionOptions{
+		Name:              "test",
+		Transport:         transport,
+		Logger:            NopLogger{},
+		CompressThreshold: 1,
+		Encryptor:         AESGCM{KeyId: "k", Keys: map[string][]byte{"k": bytes.Repeat([]byte{1}, 32)}},
+	})
+	defer session.Close(context.Background())
+
+	conn, err := transport.Dial("", amqp.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = channel.QueueDeclare("audit", false, true, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := channel.Consume("audit", "", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := bytes.Repeat([]byte("audit "), 100)
+
+	err = session.Publish("", "audit", body, PublishOptions{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := receive(deliveries)
+	if !ok {
+		t.Fatal("message wasn't published")
+	}
+	if !bytes.Equal(d.Body, body) || d.ContentEncoding != "" {
+		t.Errorf("got body %q with content encoding %q, want it as given", d.Body, d.ContentEncoding)
+	}
+}
@@ -0,0 +1,335 @@
+package remit
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// publisher wraps a channel used for publishing, optionally waiting for the
+// broker to confirm each message if the channel is in confirm mode.
+type publisher struct {
+	mu                *sync.Mutex
+	channel           Channel
+	confirm           bool
+	timeout           time.Duration
+	compressThreshold int
+	compressor        Compressor
+	encryptor         Encryptor
+	backoff           Backoff
+	logger            Logger
+	onError           func(error)
+	onReturn          func(amqp.Return)
+	tag               uint64
+	waiting           map[uint64]chan bool
+	closed            bool
+}
+
+func newPublisher(config Config) *publisher {
+	return &publisher{
+		mu:                &sync.Mutex{},
+		confirm:           config.Confirm,
+		timeout:           config.ConfirmTimeout,
+		compressThreshold: config.CompressThreshold,
+		compressor:        config.Compressor,
+		encryptor:         config.Encryptor,
+		backoff:           config.Backoff,
+		logger:            config.Logger,
+		onError:           config.OnError,
+		waiting:           make(map[uint64]chan bool),
+	}
+}
+
+// open opens a new channel on `conn` to publish with, replacing it if it's
+// closed unexpectedly whilst the connection remains open, such as after
+// publishing to an exchange that doesn't exist.
+func (p *publisher) open(conn Connection) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	err = p.reset(channel)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	go p.watchForClose(conn, channel.NotifyClose(make(chan *amqp.Error, 1)))
+
+	return nil
+}
+
+func (p *publisher) watchForClose(conn Connection, closing chan *amqp.Error) {
+	err, ok := <-closing
+	if !ok || err == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.logger.Warn("Publish channel closed; reopening", "error", err)
+
+	for attempt := 0; !conn.IsClosed(); attempt++ {
+		err := p.open(conn)
+		if err == nil {
+			return
+		}
+
+		p.logger.Error("Failed to reopen publish channel", "attempt", attempt+1, "error", err)
+		if p.onError != nil {
+			p.onError(err)
+		}
+		time.Sleep(p.backoff.Duration(attempt))
+	}
+}
+
+// reset switches the publisher over to a new channel, such as after the
+// connection has been re-established, putting it in to confirm mode if
+// needed. Any messages still waiting on a confirmation from the previous
+// channel will time out.
+func (p *publisher) reset(channel Channel) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.confirm {
+		err := channel.Confirm(false)
+		if err != nil {
+			return err
+		}
+
+		go p.watchForConfirms(channel.NotifyPublish(make(chan amqp.Confirmation, 100)))
+	}
+
+	if p.onReturn != nil {
+		go watchForReturns(channel.NotifyReturn(make(chan amqp.Return, 10)), p.onReturn)
+	}
+
+	p.channel = channel
+	p.closed = false
+	p.tag = 0
+	p.waiting = make(map[uint64]chan bool)
+
+	return nil
+}
+
+// publish compresses and encrypts the message as configured before sending
+// it using `publisher.send`.
+func (p *publisher) publish(mandatory bool, exchange string, key string, message amqp.Publishing) error {
+	err := compress(&message, p.compressThreshold, p.compressor)
+	if err != nil {
+		return err
+	}
+
+	err = encrypt(&message, p.encryptor)
+	if err != nil {
+		return err
+	}
+
+	return p.send(mandatory, exchange, key, message)
+}
+
+// send publishes the message as given, returning once it has been written
+// or, if in confirm mode, once the broker has acknowledged it.
+func (p *publisher) send(mandatory bool, exchange string, key string, message amqp.Publishing) error {
+	if !p.confirm {
+		p.mu.Lock()
+		channel := p.channel
+		p.mu.Unlock()
+
+		return channel.Publish(
+			exchange,  // exchange
+			key,       // routing key / queue
+			mandatory, // mandatory
+			false,     // immediate
+			message,   // amqp.Publishing
+		)
+	}
+
+	confirmed := make(chan bool, 1)
+
+	// delivery tags are sequential per channel, so lock around the publish
+	// to know which tag this message was given
+	p.mu.Lock()
+	err := p.channel.Publish(
+		exchange,  // exchange
+		key,       // routing key / queue
+		mandatory, // mandatory
+		false,     // immediate
+		message,   // amqp.Publishing
+	)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	p.tag++
+	tag := p.tag
+	p.waiting[tag] = confirmed
+	p.mu.Unlock()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case ack := <-confirmed:
+		if !ack {
+			return ErrPublishNacked
+		}
+
+		return nil
+	case <-timer.C:
+		p.mu.Lock()
+		delete(p.waiting, tag)
+		p.mu.Unlock()
+
+		return ErrPublishTimeout
+	}
+}
+
+func (p *publisher) watchForConfirms(confirms chan amqp.Confirmation) {
+	for confirm := range confirms {
+		p.mu.Lock()
+		confirmed := p.waiting[confirm.DeliveryTag]
+		delete(p.waiting, confirm.DeliveryTag)
+		p.mu.Unlock()
+
+		if confirmed != nil {
+			confirmed <- confirm.Ack
+		}
+	}
+}
+
+// publisherPool spreads publishing across one or more publishers, each with
+// its own channel, taking turns between them.
+type publisherPool struct {
+	publishers   []*publisher
+	next         *uint64
+	interceptors []PublishInterceptor
+}
+
+func newPublisherPool(config Config) *publisherPool {
+	size := config.PublishChannelPool
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &publisherPool{
+		publishers:   make([]*publisher, size),
+		next:         new(uint64),
+		interceptors: config.PublishInterceptors,
+	}
+
+	for i := range pool.publishers {
+		pool.publishers[i] = newPublisher(config)
+	}
+
+	return pool
+}
+
+// open opens a channel on `conn` for every publisher in the pool.
+func (pool *publisherPool) open(conn Connection) error {
+	for _, p := range pool.publishers {
+		err := p.open(conn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes every publisher's channel, returning the first error seen.
+func (pool *publisherPool) close() error {
+	var firstErr error
+
+	for _, p := range pool.publishers {
+		p.mu.Lock()
+		channel := p.channel
+		p.mu.Unlock()
+
+		if channel == nil {
+			continue
+		}
+
+		err := channel.Close()
+		if err != nil && err != amqp.ErrClosed && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (pool *publisherPool) publish(exchange string, key string, message amqp.Publishing) error {
+	return pool.publishWith(false, exchange, key, message)
+}
+
+// publishWith publishes just like `publish`, but lets the message be marked as
+// mandatory, so that it's returned if it can't be routed to any queue.
+func (pool *publisherPool) publishWith(mandatory bool, exchange string, key string, message amqp.Publishing) error {
+	intercept(pool.interceptors, exchange, key, &message)
+
+	i := atomic.AddUint64(pool.next, 1) % uint64(len(pool.publishers))
+
+	return pool.publishers[i].publish(mandatory, exchange, key, message)
+}
+
+// publishRaw publishes just like `publish`, but without compressing or
+// encrypting the message, for consumers outside of Remit that wouldn't know to
+// reverse it.
+func (pool *publisherPool) publishRaw(exchange string, key string, message amqp.Publishing) error {
+	intercept(pool.interceptors, exchange, key, &message)
+
+	i := atomic.AddUint64(pool.next, 1) % uint64(len(pool.publishers))
+
+	return pool.publishers[i].send(false, exchange, key, message)
+}
+
+// publishOn publishes just like `publishWith`, but always uses the same
+// channel for the same `pin`, so that messages sharing one, such as the
+// progress updates and reply for a single request, arrive in the order they
+// were published. Order isn't kept between separate channels.
+func (pool *publisherPool) publishOn(pin string, mandatory bool, exchange string, key string, message amqp.Publishing) error {
+	intercept(pool.interceptors, exchange, key, &message)
+
+	h := fnv.New32a()
+	h.Write([]byte(pin))
+	i := h.Sum32() % uint32(len(pool.publishers))
+
+	return pool.publishers[i].publish(mandatory, exchange, key, message)
+}
+
+// check returns `ErrPublishChannelClosed` if any publisher's channel has been
+// lost and not yet replaced.
+func (pool *publisherPool) check() error {
+	for _, p := range pool.publishers {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+
+		if closed {
+			return ErrPublishChannelClosed
+		}
+	}
+
+	return nil
+}
+
+// handleReturns passes every message returned to any of the pool's channels
+// to `fn`. It must be called before the pool is opened.
+func (pool *publisherPool) handleReturns(fn func(amqp.Return)) {
+	for _, p := range pool.publishers {
+		p.onReturn = fn
+	}
+}
+
+func watchForReturns(returns chan amqp.Return, fn func(amqp.Return)) {
+	for ret := range returns {
+		fn(ret)
+	}
+}
@@ -1,10 +1,8 @@
 package remit
 
 import (
-	"log"
 	"sync"
-
-	"github.com/streadway/amqp"
+	"time"
 )
 
 // J is a convenient aliaas for a `map[string]interface{}`, useful for dealing with
@@ -38,6 +36,18 @@ type J map[string]interface{}
 //
 // 	https://www.rabbitmq.com/uri-spec.html
 //
+// To connect over TLS, use the `amqps://` scheme. A custom `ConnectionOptions.TLSConfig`
+// can be provided for client certificates, custom CAs and the like.
+//
+// To connect to a cluster, list the other nodes in `ConnectionOptions.Urls`
+// and each will be tried in turn until one accepts the connection.
+//
+// If the connection is lost, the session reconnects, waiting between attempts
+// as set by `ConnectionOptions.Backoff`, and restores all open endpoints once connected again.
+//
+// Connect exits the process if the initial connection fails. To handle the
+// failure instead, use `Dial`.
+//
 // Example:
 //
 //	remitSession := remit.Connect(remit.ConnectionOptions{
@@ -46,66 +56,162 @@ type J map[string]interface{}
 //	})
 //
 func Connect(options ConnectionOptions) Session {
-	conn, err := amqp.Dial(options.Url)
+	session, err := Dial(options)
 	failOnError(err, "Failed to connect to RabbitMQ")
 
-	closing := conn.NotifyClose(make(chan *amqp.Error))
+	return session
+}
+
+// Dial connects to RabbitMQ just like `Connect`, but returns an error if the
+// initial connection fails rather than exiting.
+//
+// Example:
+//
+//	remitSession, err := remit.Dial(remit.ConnectionOptions{
+//		Name: "my-service",
+//		Url:  "amqp://localhost",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+func Dial(options ConnectionOptions) (Session, error) {
+	if options.Exchange == "" {
+		options.Exchange = "remit"
+	}
 
-	go func() {
-		for cl := range closing {
-			log.Println("Closed", cl.Reason)
-		}
-	}()
+	if options.ExchangeType == "" {
+		options.ExchangeType = "topic"
+	}
 
-	setupChannel, err := conn.Channel()
-	failOnError(err, "Failed to open work channel")
+	if options.Serializer == nil {
+		options.Serializer = JSONSerializer{}
+	}
 
-	err = setupChannel.ExchangeDeclare(
-		"remit", // name of the exchange
-		"topic", // type
-		true,    // durable
-		true,    // autoDelete
-		false,   // internal
-		false,   // noWait
-		nil,     // arguments
-	)
-	failOnError(err, "Failed to declare \"remit\" exchange")
-	setupChannel.Close()
+	if options.Logger == nil {
+		options.Logger = StdLogger{}
+	}
 
-	publishChannel, err := conn.Channel()
-	failOnError(err, "Failed to open publish channel")
+	if options.Propagator == nil {
+		options.Propagator = TraceContextPropagator{}
+	}
 
-	requestChannel, err := conn.Channel()
-	failOnError(err, "Failed to open replies channel")
+	if options.Tracer == nil {
+		options.Tracer = NopTracer{}
+	}
 
-	session := Session{
-		Config: Config{
-			Name: options.Name,
-			Url:  options.Url,
-		},
+	if options.Metrics == nil {
+		options.Metrics = NopMetrics{}
+	}
 
-		connection:     conn,
-		publishChannel: publishChannel,
-		requestChannel: requestChannel,
+	if options.Transport == nil {
+		options.Transport = AMQPTransport{}
+	}
+
+	if options.ConfirmTimeout == 0 {
+		options.ConfirmTimeout = 5 * time.Second
+	}
+
+	if options.Heartbeat == 0 {
+		options.Heartbeat = 10 * time.Second
+	}
+
+	options.Backoff = options.Backoff.withDefaults()
+
+	if options.Compressor == nil {
+		options.Compressor = GzipCompressor{}
+	}
+
+	compressors := map[string]Compressor{"gzip": GzipCompressor{}}
+	for encoding, compressor := range options.Compressors {
+		compressors[encoding] = compressor
+	}
+	compressors[options.Compressor.Encoding()] = options.Compressor
+
+	if options.Url != "" {
+		options.Urls = append([]string{options.Url}, options.Urls...)
+	}
+
+	if options.ReplyCheckTTL == 0 {
+		options.ReplyCheckTTL = 5 * time.Second
+	}
+
+	if options.PublishChannelPool < 1 {
+		options.PublishChannelPool = 1
+	}
+
+	config := Config{
+		Name:           options.Name,
+		Url:            options.Url,
+		Urls:           options.Urls,
+		Exchange:       options.Exchange,
+		ExchangeType:   options.ExchangeType,
+		Serializer:     options.Serializer,
+		Serializers:    options.Serializers,
+		Logger:         options.Logger,
+		Confirm:        options.Confirm,
+		ConfirmTimeout: options.ConfirmTimeout,
+		TLSConfig:      options.TLSConfig,
+		Heartbeat:      options.Heartbeat,
+		Vhost:          options.Vhost,
+		Propagator:     options.Propagator,
+		Tracer:         options.Tracer,
+
+		CompressThreshold: options.CompressThreshold,
+		Compressor:        options.Compressor,
+		Compressors:       compressors,
+		Encryptor:         options.Encryptor,
+		Decryptor:         options.Decryptor,
+		Metrics:           options.Metrics,
+		Backoff:           options.Backoff,
+
+		PublishChannelPool: options.PublishChannelPool,
+		OnError:            options.OnError,
+		AccessLog:          options.AccessLog,
+		Transport:          options.Transport,
+		OnDisconnect:       options.OnDisconnect,
+		OnReconnect:        options.OnReconnect,
+
+		PublishInterceptors: options.PublishInterceptors,
+
+		Mandatory: options.Mandatory,
+		OnReturn:  options.OnReturn,
+
+		ExchangeNonDurable:   options.ExchangeNonDurable,
+		ExchangeNoAutoDelete: options.ExchangeNoAutoDelete,
+		SkipExchangeDeclare:  options.SkipExchangeDeclare,
+
+		DelayWithTTL:  options.DelayWithTTL,
+		ReplyCheckTTL: options.ReplyCheckTTL,
+
+		Schemas: options.Schemas,
+	}
+
+	session := Session{
+		Config:     config,
+		connection: newBrokerConnection(),
+		publishers: newPublisherPool(config),
 
 		waitGroup:     &sync.WaitGroup{},
+		pending:       new(int),
+		closing:       new(bool),
 		mu:            &sync.Mutex{},
+		inFlight:      new(int64),
 		awaitingReply: make(map[string]chan Event),
-		workerPool:    newWorkerPool(1, 5, conn),
+		progress:      make(map[string]func(Event)),
+		gathering:     make(map[string]func(Event)),
+		endpoints:     make(map[*endpointState]*Endpoint),
+		exchanges:     make(map[string]bool),
+		workerPool:    newWorkerPool(1, 5),
+		replyQueues:   NewMemorySeenStore(),
+		middleware:    &[]Middleware{},
 	}
 
-	replies, err := requestChannel.Consume(
-		"amq.rabbitmq.reply-to", // name of the queue
-		"",    // consumer tag
-		true,  // noAck
-		true,  // exclusive
-		false, // noLocal
-		false, // noWait
-		nil,   // arguments
-	)
-	failOnError(err, "Failed to consume replies")
+	if config.Mandatory {
+		session.publishers.handleReturns(session.handleReturn)
+	}
 
-	go session.watchForReplies(replies)
+	err := session.dial()
 
-	return session
+	return session, err
 }
@@ -1,7 +1,8 @@
 package remit
 
 import (
-	"encoding/json"
+	"context"
+	"sync"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -16,6 +17,9 @@ import (
 // For examples of Request usage, see `Session.Request` and `Session.LazyRequest`.
 type Request struct {
 	RoutingKey string
+	Expiration time.Duration
+	Priority   uint8
+	Timeout    time.Duration
 
 	session *Session
 }
@@ -24,42 +28,351 @@ type Request struct {
 // a request.
 type RequestOptions struct {
 	RoutingKey string
+
+	// Expiration is how long each request can wait to be picked up by an
+	// endpoint before being dropped. If the context given to
+	// `Request.SendContext` has an earlier deadline, that is used instead.
+	// Zero, the default, means requests never expire.
+	Expiration time.Duration
+
+	// Priority is the priority of each request, used by endpoints declared
+	// with `EndpointOptions.MaxPriority`.
+	Priority uint8
+
+	// Timeout is how long to wait for each reply before giving up. It's
+	// applied to every send, including `Request.Send`, whose event then has
+	// its `Error` set to a `RemitError` with the code `"request_timeout"`.
+	// A context given to `Request.SendContext` with an earlier deadline takes
+	// precedence. Zero, the default, means waiting indefinitely.
+	Timeout time.Duration
+}
+
+// GatherOptions is a list of options that can be passed when gathering many
+// replies via `Request.SendAll` or `Session.RequestAll`.
+type GatherOptions struct {
+	// Replies is how many replies to wait for, returning as soon as they've
+	// all arrived. Zero, the default, means gathering every reply received
+	// within the Window.
+	Replies int
+
+	// Window is the longest to wait for replies before returning with those
+	// received so far. Requests not picked up by then expire, just like those
+	// sent with a deadline using `Request.SendContext`.
+	// Defaults to the request's `Timeout`, or 5 seconds if that's not set.
+	Window time.Duration
 }
 
 // Send sends some data to a previously-set-up `Request` using `Session.Request`.
 // It returns a channel on which a single reply `Event` will be passed upon RPC completion.
+//
+// If the request couldn't be sent, the event passed instead has its `Error`
+// set to a `RemitError` with the code `"request_failed"`.
 func (request *Request) Send(data interface{}) chan Event {
-	j, err := json.Marshal(data)
-	failOnError(err, "Failed making JSON from result")
+	receiveChannel := make(chan Event, 1)
+
+	if request.Timeout > 0 {
+		go func() {
+			event, err := request.SendContext(context.Background(), data)
+			if err != nil {
+				event = request.failure(err)
+			}
+
+			receiveChannel <- event
+		}()
+
+		return receiveChannel
+	}
+
+	_, err := request.publish(context.Background(), data, receiveChannel, nil, nil)
+	if err != nil {
+		receiveChannel <- request.failure(err)
+	}
+
+	return receiveChannel
+}
+
+// failure creates the event passed back by `Request.Send` when no reply could
+// be received.
+func (request *Request) failure(err error) Event {
+	code := "request_failed"
+	if err == context.DeadlineExceeded {
+		code = "request_timeout"
+	} else {
+		request.session.reportError("Failed to send request message", err, "routingKey", request.RoutingKey)
+	}
+
+	return Event{
+		EventType: request.RoutingKey,
+		Error:     RemitError{Code: code, Message: err.Error()},
+
+		acknowledgement: newAcknowledgement(true),
+	}
+}
+
+// SendContext sends some data to a previously-set-up `Request` and blocks until
+// either the reply is received or `ctx` is done.
+//
+// Unlike `Request.Send`, which passes back an event with a `"request_failed"`
+// or `"request_timeout"` `RemitError` if no reply could be received, failures
+// to send or to wait for the reply are returned as an error. If the responder
+// replied with an error, it is available as `Event.Error`.
+//
+// If `ctx` has a deadline, the request message expires at that point, so it's
+// never picked up by an endpoint once the caller has stopped waiting. The
+// deadline is also sent along with the request, so that an endpoint that has
+// already picked it up skips it if the deadline passes before it's handled,
+// and handlers' contexts share the same deadline. A reply arriving after `ctx`
+// is done is discarded.
+//
+// Example:
+//
+// 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// 	defer cancel()
+//
+// 	event, err := request.SendContext(ctx, remit.J{"numbers": []int{1, 5, 7}})
+//
+func (request *Request) SendContext(ctx context.Context, data interface{}) (Event, error) {
+	if request.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, request.Timeout)
+		defer cancel()
+	}
+
+	receiveChannel := make(chan Event, 1)
+	messageId, err := request.publish(ctx, data, receiveChannel, nil, nil)
+	if err != nil {
+		return Event{}, err
+	}
+
+	select {
+	case event := <-receiveChannel:
+		return event, nil
+	case <-ctx.Done():
+		request.session.unregisterReply(messageId)
+		return Event{}, ctx.Err()
+	}
+}
+
+// SendWithProgress sends some data just like `Request.SendContext`, also passing
+// any progress updates the handler sends using `Event.Progress` to `progress`
+// whilst waiting for the final reply.
+//
+// Updates are dropped rather than waited for if `progress` isn't ready to
+// receive them, so it should usually be buffered. It is not closed once the
+// final reply arrives.
+//
+// Example:
+//
+// 	progress := make(chan remit.Event, 10)
+// 	go func() {
+// 		for update := range progress {
+// 			log.Println("processed", update.Data["count"])
+// 		}
+// 	}()
+//
+// 	event, err := request.SendWithProgress(ctx, remit.J{"file": name}, progress)
+//
+func (request *Request) SendWithProgress(ctx context.Context, data interface{}, progress chan<- Event) (Event, error) {
+	if request.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, request.Timeout)
+		defer cancel()
+	}
 
 	receiveChannel := make(chan Event, 1)
+	messageId, err := request.publish(ctx, data, receiveChannel, func(update Event) {
+		select {
+		case progress <- update:
+		default:
+		}
+	}, nil)
+	if err != nil {
+		return Event{}, err
+	}
+
+	select {
+	case event := <-receiveChannel:
+		return event, nil
+	case <-ctx.Done():
+		request.session.unregisterReply(messageId)
+		return Event{}, ctx.Err()
+	}
+}
+
+// SendAll sends some data once, gathering the replies of every responder
+// that receives it rather than just the first, as set by `options`. This is
+// only useful when more than one queue is bound to the request's routing
+// key, such as endpoints with separate `EndpointOptions.Queue` names; a
+// single queue shared between many consumers still produces only one reply.
+//
+// Replies are returned in the order they arrived. Running out of time isn't
+// an error, so may return fewer replies than asked for, or none. If `ctx` is
+// done first, the replies received so far are returned along with its error.
+//
+// Example:
+//
+// 	events, err := request.SendAll(ctx, remit.J{"sku": sku}, remit.GatherOptions{
+// 		Window: 2 * time.Second,
+// 	})
+//
+func (request *Request) SendAll(ctx context.Context, data interface{}, options GatherOptions) ([]Event, error) {
+	window := options.Window
+	if window == 0 {
+		window = request.Timeout
+	}
+	if window == 0 {
+		window = 5 * time.Second
+	}
+
+	windowCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	mu := &sync.Mutex{}
+	events := []Event{}
+	gathered := make(chan bool)
+	finished := false
+
+	messageId, err := request.publish(windowCtx, data, nil, nil, func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if finished || (options.Replies > 0 && len(events) >= options.Replies) {
+			return
+		}
+
+		events = append(events, event)
+		if len(events) == options.Replies {
+			close(gathered)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-gathered:
+	case <-windowCtx.Done():
+	}
+	request.session.unregisterReply(messageId)
+
+	mu.Lock()
+	defer mu.Unlock()
+	finished = true
+
+	return events, ctx.Err()
+}
+
+// publish sends the request, passing its reply to `receiveChannel` and any
+// progress updates to `onProgress`, if set. If `onReply` is set instead of
+// `receiveChannel`, every reply is passed to it until the request is
+// unregistered, rather than just the first.
+func (request *Request) publish(ctx context.Context, data interface{}, receiveChannel chan Event, onProgress func(Event), onReply func(Event)) (string, error) {
+	err := ctx.Err()
+	if err != nil {
+		return "", err
+	}
+
+	err = request.session.hold(1)
+	if err != nil {
+		return "", err
+	}
+	defer request.session.release()
+
+	body, contentType, err := request.session.Config.Serializer.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	err = request.session.validate(request.RoutingKey, body, request.session.Config.Serializer)
+	if err != nil {
+		return "", err
+	}
+
 	messageId := ulid.MustNew(ulid.Now(), nil).String()
-	request.session.registerReply(messageId, receiveChannel)
-
-	err = request.session.requestChannel.Publish(
-		"remit",            // exchange
-		request.RoutingKey, // routing key / queue
-		false,              // mandatory
-		false,              // immediate
-		amqp.Publishing{
-			Headers:       amqp.Table{},
-			ContentType:   "application/json",
-			Body:          j,
-			Timestamp:     time.Now(),
-			MessageId:     messageId,
-			AppId:         request.session.Config.Name,
-			CorrelationId: messageId,
-			ReplyTo:       "amq.rabbitmq.reply-to",
-		},
+	ctx, endSpan := request.session.Config.Tracer.StartSpan(ctx, SpanKindProducer, request.RoutingKey)
+	defer func() {
+		endSpan(err)
+	}()
+
+	headers := amqp.Table{}
+	request.session.Config.Propagator.Inject(ctx, headers)
+	if onReply != nil {
+		request.session.registerGather(messageId, onReply)
+	} else {
+		request.session.registerReply(messageId, receiveChannel)
+	}
+	if onProgress != nil {
+		request.session.registerProgress(messageId, onProgress)
+	}
+
+	message := amqp.Publishing{
+		Headers:       headers,
+		ContentType:   contentType,
+		Body:          body,
+		Timestamp:     time.Now(),
+		MessageId:     messageId,
+		AppId:         request.session.Config.Name,
+		CorrelationId: messageId,
+		ReplyTo:       "amq.rabbitmq.reply-to",
+		Priority:      request.Priority,
+	}
+
+	ttl := request.Expiration
+	if deadline, ok := ctx.Deadline(); ok && (ttl == 0 || time.Until(deadline) < ttl) {
+		ttl = time.Until(deadline)
+	}
+
+	if ttl > 0 {
+		message.Expiration = expiration(ttl)
+		message.Headers[deadlineHeader] = time.Now().Add(ttl).UnixMilli()
+	}
+
+	intercept(request.session.Config.PublishInterceptors, request.session.Config.Exchange, request.RoutingKey, &message)
+
+	err = compress(&message, request.session.Config.CompressThreshold, request.session.Config.Compressor)
+	if err == nil {
+		err = encrypt(&message, request.session.Config.Encryptor)
+	}
+	if err != nil {
+		request.session.unregisterReply(messageId)
+		return "", err
+	}
+
+	err = request.session.connection.requests().Publish(
+		request.session.Config.Exchange,  // exchange
+		request.RoutingKey,               // routing key / queue
+		request.session.Config.Mandatory, // mandatory
+		false,                            // immediate
+		message,                          // amqp.Publishing
 	)
-	failOnError(err, "Failed to send request message")
+	if err != nil {
+		request.session.unregisterReply(messageId)
+		return "", err
+	}
 
-	return receiveChannel
+	return messageId, nil
+}
+
+// deadlineHeader carries the time, in unix milliseconds, after which the
+// requester will no longer be waiting for a reply.
+const deadlineHeader = "x-deadline"
+
+// requestDeadline returns the deadline set on a request, if any.
+func requestDeadline(headers amqp.Table) (time.Time, bool) {
+	ms, ok := headers[deadlineHeader].(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(ms), true
 }
 
 func createRequest(session *Session, options RequestOptions) Request {
 	request := Request{
 		RoutingKey: options.RoutingKey,
+		Expiration: options.Expiration,
+		Priority:   options.Priority,
+		Timeout:    options.Timeout,
 		session:    session,
 	}
 
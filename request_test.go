@@ -0,0 +1,137 @@
+package remit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestSendWithProgress(t *testing.T) {
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}})
+	defer session.Close(context.Background())
+
+	_, err := session.LazyEndpoint("rows.import", func(event Event) {
+		for i := 1; i <= 3; i++ {
+			event.Progress(J{"count": i})
+		}
+
+		event.Success <- J{"count": 3}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	progress := make(chan Event, 10)
+	request := session.Request("rows.import")
+	event, err := request.SendWithProgress(ctx, nil, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Err() != nil || event.Data["count"] != 3.0 {
+		t.Fatalf("got final reply %v with error %v", event.Data, event.Err())
+	}
+
+	if len(progress) != 3 {
+		t.Fatalf("got %d updates before the final reply, want 3", len(progress))
+	}
+	for i := 1; len(progress) > 0; i++ {
+		update := <-progress
+		if update.Data["count"] != float64(i) {
+			t.Errorf("got update %v, want count %d", update.Data, i)
+		}
+	}
+}
+
+func TestSendUnroutable(t *testing.T) {
+	returned := make(chan string, 1)
+	session := Connect(ConnectionOptions{
+		Name:      "test",
+		Transport: NewMemoryTransport(),
+		Logger:    NopLogger{},
+		Mandatory: true,
+		OnReturn: func(ret amqp.Return) {
+			returned <- ret.RoutingKey
+		},
+	})
+	defer session.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	request := session.Request("nobody.home")
+	event, err := request.SendContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remitErr, ok := event.Err().(RemitError)
+	if !ok || remitErr.Code != "unroutable" {
+		t.Errorf("got error %v, want an unroutable RemitError", event.Err())
+	}
+
+	select {
+	case key := <-returned:
+		if key != "nobody.home" {
+			t.Errorf("got %q returned, want nobody.home", key)
+		}
+	case <-time.After(time.Second):
+		t.Error("OnReturn wasn't called")
+	}
+}
+
+func TestSendAll(t *testing.T) {
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}})
+	defer session.Close(context.Background())
+
+	for _, warehouse := range []string{"a", "b", "c"} {
+		warehouse := warehouse
+
+		endpoint := session.EndpointWithOptions(EndpointOptions{
+			RoutingKey: "stock.check",
+			Queue:      "stock.check:" + warehouse,
+		})
+		endpoint.OnData(func(event Event) {
+			event.Success <- J{"warehouse": warehouse}
+		})
+
+		err := endpoint.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		options GatherOptions
+		want    int
+	}{
+		{"every reply in the window", GatherOptions{Window: 200 * time.Millisecond}, 3},
+		{"more replies than there are responders", GatherOptions{Replies: 5, Window: 200 * time.Millisecond}, 3},
+		{"as many replies as asked for", GatherOptions{Replies: 2}, 2},
+	}
+
+	for _, test := range tests {
+		request := session.Request("stock.check")
+		events, err := request.SendAll(context.Background(), nil, test.options)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if len(events) != test.want {
+			t.Errorf("%s: got %d replies, want %d", test.name, len(events), test.want)
+		}
+
+		seen := map[interface{}]bool{}
+		for _, event := range events {
+			seen[event.Data["warehouse"]] = true
+		}
+		if len(seen) != len(events) {
+			t.Errorf("%s: got the same reply more than once: %v", test.name, events)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package remit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/streadway/amqp"
+)
+
+// retryCountHeader is the header used to track how many times a message has
+// been retried.
+const retryCountHeader = "x-retry-count"
+
+// routingKeyHeader carries the routing key a message was originally published
+// with, as retrying or redriving it routes it straight to the endpoint's queue
+// by name instead.
+const routingKeyHeader = "x-remit-routing-key"
+
+// retryQueue is the name of the queue failed messages wait in before being
+// retried.
+func (endpoint Endpoint) retryQueue() string {
+	return endpoint.Queue + ":retry"
+}
+
+// delayQueue is the name of the queue messages wait in for `delay` before
+// being retried, when using `Endpoint.RetrySchedule`.
+func (endpoint Endpoint) delayQueue(delay time.Duration) string {
+	return endpoint.retryQueue() + ":" + expiration(delay)
+}
+
+// retryDelay returns how long to wait before retrying a message that has
+// already been retried `count` times.
+func (endpoint Endpoint) retryDelay(count int) time.Duration {
+	if len(endpoint.RetrySchedule) == 0 {
+		return endpoint.RetryBackoff * time.Duration(1<<uint(count))
+	}
+
+	if count >= len(endpoint.RetrySchedule) {
+		return endpoint.RetrySchedule[len(endpoint.RetrySchedule)-1]
+	}
+
+	return endpoint.RetrySchedule[count]
+}
+
+// isRetryQueue reports whether `queue` is one of those the endpoint's failed
+// messages wait in before being retried.
+func (endpoint Endpoint) isRetryQueue(queue string) bool {
+	if queue == endpoint.retryQueue() {
+		return true
+	}
+
+	for _, delay := range endpoint.RetrySchedule {
+		if queue == endpoint.delayQueue(delay) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// poisonQueue is the name of the queue messages are moved to once they've been
+// redelivered more than `Endpoint.PoisonThreshold` times.
+func (endpoint Endpoint) poisonQueue() string {
+	return endpoint.Queue + ":poison"
+}
+
+// declareRetryQueues declares the queues needed to retry, dead-letter and
+// set aside failed or invalid messages, if the endpoint is configured to do so.
+func (endpoint *Endpoint) declareRetryQueues(workChannel Channel) error {
+	// every message in a delay queue waits just as long, so each expires
+	// from the front of its queue as soon as it's due
+	for _, delay := range endpoint.RetrySchedule {
+		_, err := workChannel.QueueDeclare(
+			endpoint.delayQueue(delay), // name of the queue
+			true,                       // durable
+			false,                      // autoDelete
+			false,                      // exclusive
+			false,                      // noWait
+			amqp.Table{
+				"x-message-ttl":             int32(delay / time.Millisecond),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": endpoint.Queue,
+			}, // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("could not create endpoint delay queue: %s", err)
+		}
+	}
+
+	if endpoint.MaxRetries > 0 && len(endpoint.RetrySchedule) == 0 {
+		// messages expire from the retry queue after their backoff and are
+		// dead-lettered straight back in to the endpoint's queue. They only
+		// expire once they reach the front of it, so one with a longer
+		// backoff holds up any shorter ones queued behind it
+		_, err := workChannel.QueueDeclare(
+			endpoint.retryQueue(), // name of the queue
+			true,                  // durable
+			false,                 // autoDelete
+			false,                 // exclusive
+			false,                 // noWait
+			amqp.Table{
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": endpoint.Queue,
+			}, // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("could not create endpoint retry queue: %s", err)
+		}
+	}
+
+	if endpoint.DeadLetterRoutingKey != "" {
+		_, err := workChannel.QueueDeclare(
+			endpoint.DeadLetterRoutingKey, // name of the queue
+			true,                          // durable
+			false,                         // autoDelete
+			false,                         // exclusive
+			false,                         // noWait
+			nil,                           // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("could not create endpoint dead-letter queue: %s", err)
+		}
+
+		err = workChannel.QueueBind(
+			endpoint.DeadLetterRoutingKey,    // name of the queue
+			endpoint.DeadLetterRoutingKey,    // routing key to use
+			endpoint.session.Config.Exchange, // exchange
+			false,                            // noWait
+			nil,                              // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("could not bind dead-letter queue: %s", err)
+		}
+	}
+
+	if endpoint.PoisonThreshold > 0 {
+		_, err := workChannel.QueueDeclare(
+			endpoint.poisonQueue(), // name of the queue
+			true,                   // durable
+			false,                  // autoDelete
+			false,                  // exclusive
+			false,                  // noWait
+			nil,                    // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("could not create endpoint poison queue: %s", err)
+		}
+	}
+
+	if endpoint.InvalidQueue != "" {
+		_, err := workChannel.QueueDeclare(
+			endpoint.InvalidQueue, // name of the queue
+			true,                  // durable
+			false,                 // autoDelete
+			false,                 // exclusive
+			false,                 // noWait
+			nil,                   // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("could not create endpoint invalid-message queue: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// quarantine moves a message that has been redelivered too many times to the
+// endpoint's poison queue, acking the original. If it can't be moved, it's
+// requeued so that it isn't lost.
+func (endpoint Endpoint) quarantine(d amqp.Delivery, count int) {
+	err := endpoint.session.publishers.publish(
+		"",                                     // exchange - use default here to publish directly to queue
+		endpoint.poisonQueue(),                 // routing key / queue
+		republishing(d, retryCount(d.Headers)), // amqp.Publishing
+	)
+	if err != nil {
+		endpoint.session.reportError("Failed to move poison message; requeueing", err, "routingKey", d.RoutingKey, "messageId", d.MessageId)
+		d.Nack(false, true)
+		return
+	}
+
+	endpoint.session.Config.Logger.Warn("Moved message to poison queue", "routingKey", d.RoutingKey, "messageId", d.MessageId, "redeliveries", count, "queue", endpoint.poisonQueue())
+	d.Ack(false)
+}
+
+// Redrive moves up to `limit` messages from the endpoint's dead-letter queue
+// back in to its own queue to be handled again, such as once a bug that made
+// them fail has been fixed, returning how many were moved.
+//
+// A `limit` of zero moves as many as were in the dead-letter queue when
+// redriving started, so messages that fail again aren't redriven in a loop.
+// Moved messages get a fresh set of retries and lose their `x-death` headers.
+//
+// 	moved, err := endpoint.Redrive(0)
+//
+func (endpoint *Endpoint) Redrive(limit int) (int, error) {
+	if endpoint.DeadLetterRoutingKey == "" {
+		return 0, ErrNoDeadLetterQueue
+	}
+
+	channel, err := endpoint.session.connection.get().Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer channel.Close()
+
+	if limit == 0 {
+		queue, err := channel.QueueDeclarePassive(
+			endpoint.DeadLetterRoutingKey, // the queue to assert
+			true,                          // durable
+			false,                         // autoDelete
+			false,                         // exclusive
+			false,                         // noWait
+			nil,                           // arguments
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		limit = queue.Messages
+	}
+
+	moved := 0
+	for moved < limit {
+		d, ok, err := channel.Get(endpoint.DeadLetterRoutingKey, false)
+		if err != nil {
+			return moved, err
+		}
+		if !ok {
+			break
+		}
+
+		message := republishing(d, 0)
+		for k := range message.Headers {
+			if k == "x-death" || strings.HasPrefix(k, "x-first-death-") || strings.HasPrefix(k, "x-last-death-") {
+				delete(message.Headers, k)
+			}
+		}
+
+		err = endpoint.session.publishers.publish(
+			"",             // exchange - use default here to publish directly to queue
+			endpoint.Queue, // routing key / queue
+			message,        // amqp.Publishing
+		)
+		if err != nil {
+			d.Nack(false, true)
+			return moved, err
+		}
+
+		err = d.Ack(false)
+		if err != nil {
+			return moved, err
+		}
+
+		moved++
+	}
+
+	return moved, nil
+}
+
+// retry handles a failed message according to the endpoint's retry policy.
+//
+// If the message has retries remaining, it's published to a retry queue to
+// wait out its backoff and `true` is returned, meaning it's been dealt with.
+// Otherwise it's published to the dead-letter routing key, if set, and `false`
+// is returned so the failure can be handled as set by `Endpoint.OnFailure`.
+func (endpoint Endpoint) retry(event Event) bool {
+	count := retryCount(event.message.Headers)
+
+	if count >= endpoint.MaxRetries {
+		// other policies nack the message, which dead-letters it already
+		if endpoint.DeadLetterRoutingKey != "" && endpoint.OnFailure == FailureReply {
+			err := endpoint.session.publishers.publish(
+				endpoint.session.Config.Exchange,   // exchange
+				endpoint.DeadLetterRoutingKey,      // routing key / queue
+				republishing(event.message, count), // amqp.Publishing
+			)
+			if err != nil {
+				endpoint.session.reportError("Failed to dead-letter message", err, "routingKey", event.EventType, "messageId", event.EventId)
+			}
+		}
+
+		return false
+	}
+
+	message := republishing(event.message, count+1)
+	backoff := endpoint.retryDelay(count)
+
+	queue := endpoint.retryQueue()
+	if len(endpoint.RetrySchedule) > 0 {
+		queue = endpoint.delayQueue(backoff)
+	} else {
+		message.Expiration = strconv.FormatInt(int64(backoff/time.Millisecond), 10)
+	}
+
+	err := endpoint.session.publishers.publish(
+		"",      // exchange - use default here to publish directly to queue
+		queue,   // routing key / queue
+		message, // amqp.Publishing
+	)
+	if err != nil {
+		endpoint.session.reportError("Failed to queue message for retry; requeueing", err, "routingKey", event.EventType, "messageId", event.EventId)
+		event.Nack(true)
+		return true
+	}
+
+	endpoint.session.Config.Logger.Debug("Retrying failed message", "routingKey", event.EventType, "messageId", event.EventId, "retry", count+1, "backoff", backoff)
+	event.Ack()
+
+	return true
+}
+
+// republishing copies a delivery in to a new publishing with the given retry
+// count, keeping everything needed to reply to the original request.
+func republishing(d amqp.Delivery, count int) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = int32(count)
+	headers[routingKeyHeader] = routingKey(d)
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		Body:            d.Body,
+		Timestamp:       time.Now(),
+		MessageId:       ulid.MustNew(ulid.Now(), nil).String(),
+		AppId:           d.AppId,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+	}
+}
+
+// routingKey returns the routing key `d` was originally published with,
+// before any retries or dead-lettering moved it between queues.
+func routingKey(d amqp.Delivery) string {
+	if key, ok := d.Headers[routingKeyHeader].(string); ok {
+		return key
+	}
+
+	// the oldest death is last, and was routed with the original key
+	if entries, ok := d.Headers["x-death"].([]interface{}); ok && len(entries) > 0 {
+		if death, ok := entries[len(entries)-1].(amqp.Table); ok {
+			if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+				if key, ok := keys[0].(string); ok {
+					return key
+				}
+			}
+		}
+	}
+
+	return d.RoutingKey
+}
+
+// redeliveryCount returns how many times a message has been delivered before,
+// using the `x-delivery-count` header set by quorum queues and the counts in
+// any `x-death` headers added by dead-lettering. Other redeliveries are only
+// flagged by `Redelivered`, so count as one.
+//
+// Messages expiring from the endpoint's own retry queues are being retried
+// rather than redelivered, so those deaths aren't counted.
+func (endpoint Endpoint) redeliveryCount(d amqp.Delivery) int {
+	count := toInt(d.Headers["x-delivery-count"])
+
+	deaths := 0
+	if entries, ok := d.Headers["x-death"].([]interface{}); ok {
+		for _, entry := range entries {
+			if death, ok := entry.(amqp.Table); ok {
+				if queue, _ := death["queue"].(string); endpoint.isRetryQueue(queue) {
+					continue
+				}
+
+				deaths += toInt(death["count"])
+			}
+		}
+	}
+	if deaths > count {
+		count = deaths
+	}
+
+	if count == 0 && d.Redelivered {
+		count = 1
+	}
+
+	return count
+}
+
+// retryCount returns the number of times a message has been retried.
+func retryCount(headers amqp.Table) int {
+	return toInt(headers[retryCountHeader])
+}
+
+// toInt converts the integer types a header can be decoded as to an int.
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,177 @@
+package remit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestRedeliveryCount(t *testing.T) {
+	tests := []struct {
+		name string
+		d    amqp.Delivery
+		want int
+	}{
+		{"first delivery", amqp.Delivery{}, 0},
+		{"redelivered flag", amqp.Delivery{Redelivered: true}, 1},
+		{"quorum delivery count", amqp.Delivery{Redelivered: true, Headers: amqp.Table{"x-delivery-count": int64(3)}}, 3},
+		{"dead-lettered", amqp.Delivery{Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"count": int64(2), "queue": "a.dlq"},
+			amqp.Table{"count": int64(1), "queue": "a"},
+		}}}, 3},
+		{"retried", amqp.Delivery{Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"count": int64(2), "queue": "a:retry"},
+			amqp.Table{"count": int64(1), "queue": "a:retry:1000"},
+			amqp.Table{"count": int64(1), "queue": "a"},
+		}}}, 1},
+		{"most of both", amqp.Delivery{Headers: amqp.Table{
+			"x-delivery-count": int32(5),
+			"x-death":          []interface{}{amqp.Table{"count": int64(2)}},
+		}}, 5},
+	}
+
+	endpoint := Endpoint{Queue: "a", RetrySchedule: []time.Duration{time.Second}}
+
+	for _, test := range tests {
+		got := endpoint.redeliveryCount(test.d)
+		if got != test.want {
+			t.Errorf("%s: redeliveryCount = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRoutingKey(t *testing.T) {
+	tests := []struct {
+		name string
+		d    amqp.Delivery
+		want string
+	}{
+		{"as delivered", amqp.Delivery{RoutingKey: "user.created"}, "user.created"},
+		{"retried", amqp.Delivery{RoutingKey: "users", Headers: amqp.Table{routingKeyHeader: "user.created"}}, "user.created"},
+		{"dead-lettered", amqp.Delivery{RoutingKey: "users.dlq", Headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"routing-keys": []interface{}{"users"}},
+			amqp.Table{"routing-keys": []interface{}{"user.created"}},
+		}}}, "user.created"},
+	}
+
+	for _, test := range tests {
+		got := routingKey(test.d)
+		if got != test.want {
+			t.Errorf("%s: routingKey = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		count    int
+		want     time.Duration
+	}{
+		{"backoff", Endpoint{RetryBackoff: time.Second}, 0, time.Second},
+		{"doubled backoff", Endpoint{RetryBackoff: time.Second}, 3, 8 * time.Second},
+		{"schedule", Endpoint{RetrySchedule: []time.Duration{time.Second, time.Minute}}, 1, time.Minute},
+		{"past the schedule", Endpoint{RetrySchedule: []time.Duration{time.Second, time.Minute}}, 5, time.Minute},
+	}
+
+	for _, test := range tests {
+		got := test.endpoint.retryDelay(test.count)
+		if got != test.want {
+			t.Errorf("%s: retryDelay(%d) = %v, want %v", test.name, test.count, got, test.want)
+		}
+	}
+}
+
+func TestRepublishing(t *testing.T) {
+	d := amqp.Delivery{
+		RoutingKey:    "user.created",
+		Headers:       amqp.Table{"x-custom": "kept"},
+		ContentType:   "application/json",
+		Body:          []byte(`{}`),
+		CorrelationId: "abc",
+		ReplyTo:       "amq.rabbitmq.reply-to",
+	}
+
+	message := republishing(d, 2)
+
+	if retryCount(message.Headers) != 2 {
+		t.Errorf("got retry count %v, want 2", message.Headers[retryCountHeader])
+	}
+	if message.Headers[routingKeyHeader] != "user.created" {
+		t.Errorf("got routing key header %v, want user.created", message.Headers[routingKeyHeader])
+	}
+	if message.Headers["x-custom"] != "kept" || message.CorrelationId != "abc" || message.ReplyTo != d.ReplyTo {
+		t.Errorf("lost details of the original message: %+v", message)
+	}
+	if _, ok := d.Headers[retryCountHeader]; ok {
+		t.Error("modified the original message's headers")
+	}
+}
+
+func TestRetriesExhaustedWithRequeue(t *testing.T) {
+	transport := NewMemoryTransport()
+	session := Connect(ConnectionOptions{Name: "test", Transport: transport, Logger: NopLogger{}})
+	defer session.Close(context.Background())
+
+	calls := make(chan bool, 10)
+	endpoint := session.EndpointWithOptions(EndpointOptions{
+		RoutingKey:           "jobs.run",
+		Queue:                "jobs.run",
+		MaxRetries:           2,
+		DeadLetterRoutingKey: "jobs.dead",
+		OnFailure:            FailureRequeue,
+	})
+	endpoint.OnData(func(event Event) {
+		calls <- true
+		event.Failure <- "failed"
+	})
+
+	err := endpoint.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := transport.Dial("", amqp.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := channel.Consume("jobs.dead", "", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a message that's already been retried as many times as allowed
+	err = session.Publish("", "jobs.run", J{}, PublishOptions{
+		Headers: amqp.Table{retryCountHeader: int32(2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if len(calls) != 1 {
+		t.Errorf("handled %d times, want once", len(calls))
+	}
+
+	copies := 0
+	for ok := true; ok; {
+		_, ok = receive(dead)
+		if ok {
+			copies++
+		}
+	}
+	if copies > 1 {
+		t.Errorf("dead-lettered %d copies", copies)
+	}
+}
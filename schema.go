@@ -0,0 +1,89 @@
+package remit
+
+import (
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+// Schema validates the data of incoming messages before they're handed to an
+// endpoint's handlers, and of outgoing messages before they're published.
+// See `EndpointOptions.Schema` and `ConnectionOptions.Schemas`.
+//
+// Remit doesn't ship with a JSON schema implementation, so that any can be
+// used. For example, wrapping `github.com/santhosh-tekuri/jsonschema`:
+//
+// 	compiled := jsonschema.MustCompile("schemas/user.json")
+//
+// 	schema := remit.SchemaFunc(func(data remit.EventData) error {
+// 		return compiled.Validate(map[string]interface{}(data))
+// 	})
+//
+type Schema interface {
+	Validate(data EventData) error
+}
+
+// SchemaFunc lets a plain function be used as a `Schema`.
+type SchemaFunc func(data EventData) error
+
+// Validate calls `f(data)`.
+func (f SchemaFunc) Validate(data EventData) error {
+	return f(data)
+}
+
+// invalidReasonHeader carries why a message moved to an endpoint's
+// `InvalidQueue` failed validation.
+const invalidReasonHeader = "x-remit-invalid-reason"
+
+// validate checks `body`, encoded using `serializer`, against the schema
+// registered for `key` in `Config.Schemas`, if any, so that invalid messages
+// fail before being published.
+func (session *Session) validate(key string, body []byte, serializer Serializer) error {
+	schema := session.Config.Schemas[key]
+	if schema == nil {
+		return nil
+	}
+
+	var data EventData
+	err := serializer.Unmarshal(body, &data)
+	if err == nil {
+		err = schema.Validate(data)
+	}
+	if err != nil {
+		return fmt.Errorf("message for %q failed schema validation: %w", key, err)
+	}
+
+	return nil
+}
+
+// schemaFor returns the schema messages received with `routingKey` are
+// validated against, which is the endpoint's own `Schema` if set.
+func (endpoint *Endpoint) schemaFor(routingKey string) Schema {
+	if endpoint.Schema != nil {
+		return endpoint.Schema
+	}
+
+	return endpoint.session.Config.Schemas[routingKey]
+}
+
+// moveInvalid moves a message that failed validation to the endpoint's
+// `InvalidQueue`, noting why in its headers, and acks the original. If it
+// can't be moved, it's requeued so that it isn't lost.
+func (endpoint Endpoint) moveInvalid(d amqp.Delivery, reason error) {
+	message := republishing(d, retryCount(d.Headers))
+	message.Headers[invalidReasonHeader] = reason.Error()
+
+	err := endpoint.session.publishers.publish(
+		"",                    // exchange - use default here to publish directly to queue
+		endpoint.InvalidQueue, // routing key / queue
+		message,               // amqp.Publishing
+	)
+	if err != nil {
+		endpoint.session.reportError("Failed to move invalid message; requeueing", err, "routingKey", d.RoutingKey, "messageId", d.MessageId)
+		d.Nack(false, true)
+		return
+	}
+
+	endpoint.session.Config.Logger.Warn("Moved message failing schema validation to invalid queue", "routingKey", d.RoutingKey, "messageId", d.MessageId, "queue", endpoint.InvalidQueue, "error", reason)
+	d.Ack(false)
+}
@@ -0,0 +1,59 @@
+package remit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPublishSchemas(t *testing.T) {
+	session := Connect(ConnectionOptions{
+		Name:      "test",
+		Transport: NewMemoryTransport(),
+		Logger:    NopLogger{},
+		Schemas: map[string]Schema{
+			"user.created": SchemaFunc(func(data EventData) error {
+				if data["id"] == nil {
+					return errors.New("missing id")
+				}
+
+				return nil
+			}),
+		},
+	})
+	defer session.Close(context.Background())
+
+	txPublish := func(exchange string, key string, data interface{}, options PublishOptions) error {
+		tx, err := session.Tx()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		return tx.Publish(exchange, key, data, options)
+	}
+
+	publishers := map[string]func(string, string, interface{}, PublishOptions) error{
+		"Session.Publish": session.Publish,
+		"Tx.Publish":      txPublish,
+	}
+
+	tests := []struct {
+		exchange string
+		data     J
+		wantErr  bool
+	}{
+		{"remit", J{"id": 1}, false},
+		{"remit", J{}, true},
+		{"", J{}, false},
+	}
+
+	for name, publish := range publishers {
+		for _, test := range tests {
+			err := publish(test.exchange, "user.created", test.data, PublishOptions{})
+			if (err != nil) != test.wantErr {
+				t.Errorf("%s to %q with %v: got error %v, want error = %v", name, test.exchange, test.data, err, test.wantErr)
+			}
+		}
+	}
+}
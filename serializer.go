@@ -0,0 +1,31 @@
+package remit
+
+import "encoding/json"
+
+// Serializer is used to encode and decode message bodies being sent and received
+// by Remit.
+//
+// `Marshal` returns the encoded body along with the content type it should be
+// published with, such as `"application/json"`.
+//
+// The default serializer is `JSONSerializer`, but any can be provided when
+// connecting using `ConnectionOptions.Serializer`.
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, string, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONSerializer is the default `Serializer`, encoding messages as JSON.
+type JSONSerializer struct{}
+
+// Marshal encodes `v` as JSON.
+func (JSONSerializer) Marshal(v interface{}) ([]byte, string, error) {
+	j, err := json.Marshal(v)
+
+	return j, "application/json", err
+}
+
+// Unmarshal decodes the JSON in `data` in to `v`.
+func (JSONSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
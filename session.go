@@ -1,14 +1,18 @@
 package remit
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"crypto/tls"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/oklog/ulid"
 	"github.com/streadway/amqp"
 )
 
@@ -16,8 +20,50 @@ import (
 // the RabbitMQ server, as well as some Remit-specific options such as
 // the service name.
 type Config struct {
-	Name string
-	Url  string
+	Name           string
+	Url            string
+	Urls           []string
+	Exchange       string
+	ExchangeType   string
+	Serializer     Serializer
+	Serializers    map[string]Serializer
+	Logger         Logger
+	Confirm        bool
+	ConfirmTimeout time.Duration
+	TLSConfig      *tls.Config
+	Heartbeat      time.Duration
+	Vhost          string
+	Propagator     Propagator
+	Tracer         Tracer
+
+	CompressThreshold  int
+	Compressor         Compressor
+	Compressors        map[string]Compressor
+	Encryptor          Encryptor
+	Decryptor          Decryptor
+	Metrics            Metrics
+	Backoff            Backoff
+	PublishChannelPool int
+	OnError            func(error)
+	AccessLog          bool
+	Transport          Transport
+	OnDisconnect       func(error)
+	OnReconnect        func(attempts int)
+
+	PublishInterceptors []PublishInterceptor
+
+	Mandatory bool
+	OnReturn  func(amqp.Return)
+
+	ExchangeNonDurable   bool
+	ExchangeNoAutoDelete bool
+	SkipExchangeDeclare  bool
+
+	DelayWithTTL bool
+
+	ReplyCheckTTL time.Duration
+
+	Schemas map[string]Schema
 }
 
 // ConnectionOptions is the options used to connect to RabbitMQ and
@@ -25,6 +71,180 @@ type Config struct {
 type ConnectionOptions struct {
 	Url  string
 	Name string
+
+	// Urls are further brokers to connect to, such as the other nodes of a
+	// cluster. Each is tried in turn, starting with `Url` if given, until one
+	// accepts the connection. If the connection is later lost, reconnecting
+	// starts from the next one along, so that a node going down doesn't leave
+	// the session waiting for it to come back.
+	Urls []string
+
+	// Exchange is the name of the exchange all messages are routed through
+	// and ExchangeType is the AMQP type it's declared as.
+	// Defaults to a `"topic"` exchange named `"remit"`.
+	Exchange     string
+	ExchangeType string
+
+	// ExchangeNonDurable and ExchangeNoAutoDelete change how the exchange is
+	// declared. By default it's durable, surviving broker restarts, and is
+	// deleted once no queues are bound to it.
+	ExchangeNonDurable   bool
+	ExchangeNoAutoDelete bool
+
+	// SkipExchangeDeclare assumes the exchange already exists, such as when
+	// it's managed by separate tooling or the user connecting isn't allowed
+	// to declare it, rather than declaring it when connecting.
+	SkipExchangeDeclare bool
+
+	// Serializer is used to encode and decode message bodies.
+	// Defaults to `JSONSerializer`.
+	Serializer Serializer
+
+	// Serializers are additional serializers, keyed by the content type they
+	// handle. Messages received with one of these content types are decoded
+	// with the matching serializer and replied to using the same one, so that
+	// requesters get back the encoding they sent. Everything else uses
+	// `Serializer`.
+	Serializers map[string]Serializer
+
+	// Logger is used to report errors and other notable events.
+	// Defaults to `StdLogger`.
+	Logger Logger
+
+	// Confirm puts the publish channel in to confirm mode, so that replies and
+	// emissions wait for the broker to acknowledge them. A reply that isn't
+	// confirmed within ConfirmTimeout (5 seconds by default) causes the
+	// original message to be requeued.
+	Confirm        bool
+	ConfirmTimeout time.Duration
+
+	// TLSConfig is used when connecting to a `Url` with the `amqps://` scheme.
+	// If nil, the system's default TLS settings are used.
+	TLSConfig *tls.Config
+
+	// Heartbeat is the interval heartbeats are sent to the broker, 10 seconds
+	// by default.
+	Heartbeat time.Duration
+
+	// Vhost overrides the virtual host given in `Url`, if any.
+	Vhost string
+
+	// Propagator carries trace context across services using message headers.
+	// Defaults to `TraceContextPropagator`.
+	Propagator Propagator
+
+	// Tracer creates a span for every request and emission published and every
+	// message handled.
+	// Defaults to `NopTracer`.
+	Tracer Tracer
+
+	// CompressThreshold is the size in bytes above which message bodies are
+	// compressed with Compressor before publishing, except for those sent
+	// using `Session.Publish` or `Tx.Publish`. Compressed messages are
+	// always decompressed when received, regardless of this setting.
+	// Zero, the default, disables compression.
+	CompressThreshold int
+
+	// Compressor compresses message bodies larger than CompressThreshold.
+	// Defaults to `GzipCompressor`.
+	Compressor Compressor
+
+	// Compressors are additional compressors, keyed by the content encoding
+	// they handle, used only for decompressing messages received. Messages
+	// compressed with gzip or Compressor are always decompressed.
+	Compressors map[string]Compressor
+
+	// Encryptor encrypts the body of every message published other than
+	// those sent using `Session.Publish` or `Tx.Publish`, and Decryptor
+	// decrypts those received that were encrypted. Messages received that
+	// weren't encrypted are handled as usual. See `Encryptor` for the format
+	// of encrypted messages.
+	Encryptor Encryptor
+	Decryptor Decryptor
+
+	// Metrics is notified as messages are received, processed and replied to.
+	// Defaults to `NopMetrics`.
+	Metrics Metrics
+
+	// Backoff controls the delay between attempts to reconnect if the
+	// connection or an endpoint's channel is lost.
+	// Defaults to `DefaultBackoff`.
+	Backoff Backoff
+
+	// PublishChannelPool is how many channels to spread emissions, replies
+	// and other publishing across, which can help throughput when publishing
+	// from many goroutines at once. Requests are always sent on their own
+	// channel.
+	// Defaults to 1.
+	PublishChannelPool int
+
+	// OnError is called with any error Remit encounters in the background,
+	// such as whilst reconnecting or replying to a message, which would
+	// otherwise only be logged. Remit carries on regardless, so this is for
+	// reporting rather than recovery.
+	OnError func(error)
+
+	// AccessLog logs a single line at the info level for every message an
+	// endpoint handles, detailing its routing key, message and correlation
+	// IDs, how long it took to handle, the outcome and whether a reply was
+	// sent.
+	AccessLog bool
+
+	// Transport is used to connect to the broker.
+	// Defaults to `AMQPTransport`, connecting to RabbitMQ at `Url`.
+	Transport Transport
+
+	// OnDisconnect is called with the reason the connection was lost, before
+	// Remit starts trying to reconnect. Failed attempts are passed to
+	// `OnError` and OnReconnect is called with how many attempts it took once
+	// connected again. Neither is called when the session is closed.
+	OnDisconnect func(error)
+	OnReconnect  func(attempts int)
+
+	// PublishInterceptors are run in order for every message published,
+	// such as to add a tenant ID or host details to its headers:
+	//
+	// 	PublishInterceptors: []remit.PublishInterceptor{
+	// 		func(exchange string, key string, message *amqp.Publishing) {
+	// 			message.Headers["x-tenant"] = tenant
+	// 		},
+	// 	},
+	//
+	PublishInterceptors []PublishInterceptor
+
+	// Mandatory publishes requests and replies as mandatory, so that the
+	// broker returns them if they can't be routed to any queue rather than
+	// dropping them. A returned request is replied to straight away with a
+	// `RemitError` with the code `"unroutable"`. Every returned message is
+	// logged and passed to OnReturn, if set.
+	Mandatory bool
+	OnReturn  func(amqp.Return)
+
+	// DelayWithTTL delays messages without needing the
+	// `rabbitmq_delayed_message_exchange` plugin, by publishing them to a
+	// queue per routing key and delay which holds them for that long before
+	// dead-lettering them to the exchange. These queues are declared as
+	// needed and deleted by the broker once they've gone unused.
+	//
+	// Messages delayed this way never expire, regardless of
+	// `EmitOptions.Expiration`, as an expiration shorter than the delay would
+	// see them delivered early.
+	DelayWithTTL bool
+
+	// ReplyCheckTTL is how long a reply queue is remembered as existing once
+	// checked, so that replies to a busy requester don't each cost an extra
+	// round trip to the broker. A reply sent to a queue that's gone within
+	// this time is dropped by the broker, or returned if `Mandatory` is set.
+	// Defaults to 5 seconds. A negative value checks before every reply.
+	ReplyCheckTTL time.Duration
+
+	// Schemas validates messages by routing key. Emissions, requests and
+	// messages published to `Exchange` using `Session.Publish` or a `Tx` that
+	// don't match the schema for their routing key fail before being
+	// published, and endpoints receiving them treat them as they would those
+	// failing their own `EndpointOptions.Schema`. Messages published to any
+	// other exchange aren't validated.
+	Schemas map[string]Schema
 }
 
 // Session represents a communication session with RabbitMQ.
@@ -35,47 +255,93 @@ type Session struct {
 	// the config given for this connection
 	Config Config
 
-	connection     *amqp.Connection
-	publishChannel *amqp.Channel
-	requestChannel *amqp.Channel
-	awaitingReply  map[string]chan Event
-	workerPool     *workerPool
-	listenerCount  int
+	connection    *brokerConnection
+	publishers    *publisherPool
+	awaitingReply map[string]chan Event
+	progress      map[string]func(Event)
+	gathering     map[string]func(Event)
+	endpoints     map[*endpointState]*Endpoint
+	exchanges     map[string]bool
+	workerPool    *workerPool
+	replyQueues   *MemorySeenStore
+	middleware    *[]Middleware
+	listenerCount int
 
 	waitGroup *sync.WaitGroup
+	pending   *int
+	closing   *bool
+	inFlight  *int64
 	mu        *sync.Mutex
 }
 
-// Close closes the Remit session by waiting for all unacknowledged messages to be
-// handled before closing the RabbitMQ connection and pushing `true` to the returned
-// channel.
+// Close closes the Remit session, first cancelling consumption for all open
+// endpoints so that no new messages are received, then waiting for all
+// unacknowledged messages to be handled and their replies published before
+// closing the publish channels and then the RabbitMQ connection.
+//
+// If `ctx` is done before all messages have been handled, an error is returned
+// detailing how many were still in progress and the connection is left open.
+//
+// Once closing has begun, emissions, requests and publishes are only accepted
+// from handlers still running; anything else fails with `ErrSessionClosed`.
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
-// 	...
-// 	<-remitSession.Close()
+//	remitSession := remit.Connect(...)
+//	...
+//	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
 //
-func (session *Session) Close() chan bool {
-	ch := make(chan bool)
-	logClosure()
+//	err := remitSession.Close(ctx)
+func (session *Session) Close(ctx context.Context) error {
+	session.Config.Logger.Info("Initiated Remit closure.")
+
+	session.mu.Lock()
+	*session.closing = true
+	endpoints := make([]*Endpoint, 0, len(session.endpoints))
+	for _, endpoint := range session.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	session.mu.Unlock()
 
+	for _, endpoint := range endpoints {
+		endpoint.stopConsuming()
+	}
+
+	drained := make(chan bool)
 	go func() {
 		session.waitGroup.Wait()
-		err := session.connection.Close()
-		failOnError(err, "Failed to close connection to RabbitMQ safely")
-		log.Println("  [x] Safely closed AMQP connection")
-		ch <- true
+		close(drained)
 	}()
 
-	return ch
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return fmt.Errorf("remit: %d message(s) still being handled: %s", atomic.LoadInt64(session.inFlight), ctx.Err())
+	}
+
+	// every reply and emission has been published by now, so the publish
+	// channels can be closed before the connection
+	err := session.publishers.close()
+	if err != nil {
+		session.reportError("Failed to close publish channels", err)
+	}
+
+	err = session.connection.get().Close()
+	if err != nil {
+		return err
+	}
+
+	session.Config.Logger.Info("Safely closed AMQP connection")
+
+	return nil
 }
 
 // CloseOnSignal returns a channel that will receive either `true` or `false`
 // depending on whether Remit closed its connections safely as a result of
 // an interruption signal.
 //
-// The receipt of a signal causes the session to close via `Session.Close()`.
+// The receipt of a signal causes the session to close via `Session.Close`.
 // A second signal being sent whilst the close is in progress will perform a
 // "cold" shutdown, dismissing any unacknowledged messages and returning `false`
 // to the channel straight away.
@@ -84,10 +350,9 @@ func (session *Session) Close() chan bool {
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
-// 	...
-// 	<-remitSession.CloseOnSignal()
-//
+//	remitSession := remit.Connect(...)
+//	...
+//	<-remitSession.CloseOnSignal()
 func (session *Session) CloseOnSignal() chan bool {
 	ch := make(chan bool)
 
@@ -101,16 +366,18 @@ func (session *Session) CloseOnSignal() chan bool {
 			syscall.SIGTERM, // Termination
 		)
 		<-c
-		logClosure()
+		session.logClosure()
 		go func() {
-			session.waitGroup.Wait()
-			err := session.connection.Close()
-			failOnError(err, "Failed to close connection to RabbitMQ safely")
-			log.Println("  [x] Safely closed AMQP connection")
+			err := session.Close(context.Background())
+			if err != nil {
+				session.reportError("Failed to close connection to RabbitMQ safely", err)
+				ch <- false
+				return
+			}
 			ch <- true
 		}()
 		<-c
-		log.Println("  [x] Cold shutdown - killing self regardless of message loss...")
+		session.Config.Logger.Warn("Cold shutdown - killing self regardless of message loss...")
 		ch <- false
 	}()
 
@@ -124,18 +391,17 @@ func (session *Session) CloseOnSignal() chan bool {
 // don't care about the response.
 //
 // `key` will be used as a routing key and emissions are always published to the
-// `"remit"` exchange.
+// exchange set in `Config.Exchange`, `"remit"` by default.
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
-//
-// 	emitter := remitSession.Emit("service.connected")
-// 	emitter <- "my-service-id"
+//	remitSession := remit.Connect(...)
 //
-// 	// is synonymous with
-// 	remitSession.LazyEmit("service.connected", "my-service-id")
+//	emitter := remitSession.Emit("service.connected")
+//	emitter <- "my-service-id"
 //
+//	// is synonymous with
+//	remitSession.LazyEmit("service.connected", "my-service-id")
 func (session *Session) Emit(key string) chan interface{} {
 	emit := createEmission(session, EmitOptions{
 		RoutingKey: key,
@@ -144,19 +410,40 @@ func (session *Session) Emit(key string) chan interface{} {
 	return emit.Channel
 }
 
+// EmitWithOptions sets up an emitter like `Session.Emit`, using the options
+// described in the `EmitOptions` type.
+//
+// Example:
+//
+//	emitter := remitSession.EmitWithOptions(remit.EmitOptions{
+//		RoutingKey: "price.updated",
+//		Expiration: 10 * time.Second,
+//	})
+//
+//	orders := remitSession.EmitWithOptions(remit.EmitOptions{
+//		RoutingKey: "order.placed",
+//		Persistent: true,
+//		Headers:    amqp.Table{"x-tenant": tenant},
+//	})
+func (session *Session) EmitWithOptions(options EmitOptions) chan interface{} {
+	emit := createEmission(session, options)
+
+	return emit.Channel
+}
+
 // Endpoint creates an endpoint for `key` but does not start consuming.
 // For a one-liner endpoint, see `Session.LazyEndpoint`.
 //
 // Using this, the usual set-up is to also add a data handler and then open
 // the endpoint for messages:
 //
-// 	endpoint := remitSession.Endpoint("math.sum")
-// 	endpoint.OnData(sumHandler)
-// 	endpoint.Open()
+//	endpoint := remitSession.Endpoint("math.sum")
+//	endpoint.OnData(sumHandler)
+//	endpoint.Open()
 //
 // This would be synonymous with `Session.LazyEndpoint`'s:
 //
-// 	endpoint := remitSession.LazyEndpoint("math.sum", sumHandler)
+//	endpoint, err := remitSession.LazyEndpoint("math.sum", sumHandler)
 //
 // When this endpoint is created, both the `RoutingKey` and `Queue` will be set to
 // the provided `key`. If you'd like to specify them as separate entities, see
@@ -164,12 +451,11 @@ func (session *Session) Emit(key string) chan interface{} {
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
-//
-// 	endpoint := remitSession.Endpoint("math.sum")
-// 	endpoint.OnData(sumHandler)
-// 	endpoint.Open()
+//	remitSession := remit.Connect(...)
 //
+//	endpoint := remitSession.Endpoint("math.sum")
+//	endpoint.OnData(sumHandler)
+//	endpoint.Open()
 func (session *Session) Endpoint(key string) Endpoint {
 	endpoint := createEndpoint(session, EndpointOptions{
 		RoutingKey:  key,
@@ -188,14 +474,28 @@ func (session *Session) Endpoint(key string) Endpoint {
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
+//	remitSession := remit.Connect(...)
 //
-// 	endpoint := EndpointWithOptions(remit.EndpointOptions{
-// 		RoutingKey: "maths",
+//	endpoint := EndpointWithOptions(remit.EndpointOptions{
+//		RoutingKey: "maths",
 //		Queue: "math.sum",
-// 	})
+//	})
+//
+// To bind a single queue to several routing keys, use `RoutingKeys`. The
+// routing key each message was sent with is available as `Event.EventType`,
+// and is kept when messages are retried or redriven, so it can still be used
+// to tell them apart, and to pick their schema from
+// `ConnectionOptions.Schemas`.
 //
+//	endpoint := EndpointWithOptions(remit.EndpointOptions{
+//		RoutingKeys: []string{"user.create", "user.update", "user.delete"},
+//		Queue: "user.commands",
+//	})
 func (session *Session) EndpointWithOptions(options EndpointOptions) Endpoint {
+	if options.RoutingKey == "" && len(options.RoutingKeys) > 0 {
+		options.RoutingKey = options.RoutingKeys[0]
+	}
+
 	if options.Queue == "" && options.RoutingKey == "" {
 		panic("No queue or routing key given")
 	}
@@ -208,30 +508,67 @@ func (session *Session) EndpointWithOptions(options EndpointOptions) Endpoint {
 		options.Queue = options.RoutingKey
 	}
 
-	endpoint := createEndpoint(session, EndpointOptions{
-		RoutingKey:  options.RoutingKey,
-		Queue:       options.Queue,
-		shouldReply: true,
-	})
+	options.shouldReply = true
+	endpoint := createEndpoint(session, options)
 
 	return endpoint
 }
 
-// LazyEmit immediately publishes a message using `Session.Emit` using the given routing
-// key and data.
+// LazyEmit immediately publishes a message using the given routing key and data,
+// returning any error encountered whilst publishing.
+//
+// Unlike `Session.Emit`, the message is published before returning, so a closed
+// channel or connection is reported to the caller rather than just logged.
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
+//	remitSession := remit.Connect(...)
+//
+//	err := remitSession.LazyEmit("service.connected", "my-service-id")
+func (session *Session) LazyEmit(key string, data interface{}) error {
+	emit := Emit{
+		RoutingKey: key,
+		session:    session,
+	}
+
+	return emit.send(data)
+}
+
+// EmitDelayed publishes a message like `Session.LazyEmit`, but the broker will
+// wait for `delay` before routing it to any queues.
 //
-// 	remitSession.LazyEmit("service.connceted", "my-service-id")
+// This requires the `rabbitmq_delayed_message_exchange` plugin to be enabled
+// on the broker, as delayed messages are published via an `x-delayed-message`
+// exchange named after `Config.Exchange` with a `.delayed` suffix. It's
+// declared the first time it's needed and bound to the main exchange.
 //
-func (session *Session) LazyEmit(key string, data interface{}) {
-	emit := createEmission(session, EmitOptions{
+// If the plugin isn't available, set `ConnectionOptions.DelayWithTTL` to use
+// TTL queues instead.
+//
+// Example:
+//
+//	remitSession := remit.Connect(...)
+//
+//	err := remitSession.EmitDelayed("reminder.send", remit.J{"id": 123}, 30*time.Second)
+func (session *Session) EmitDelayed(key string, data interface{}, delay time.Duration) error {
+	emit := Emit{
 		RoutingKey: key,
-	})
+		Delay:      delay,
+		session:    session,
+	}
+
+	return emit.send(data)
+}
 
-	emit.Channel <- data
+// EmitAt publishes a message like `Session.EmitDelayed`, scheduling it to be
+// routed at `at` rather than after a delay. If `at` has already passed, the
+// message is published straight away.
+//
+// Example:
+//
+//	err := remitSession.EmitAt("subscription.expired", remit.J{"id": 123}, subscription.ExpiresAt)
+func (session *Session) EmitAt(key string, data interface{}, at time.Time) error {
+	return session.EmitDelayed(key, data, time.Until(at))
 }
 
 // LazyEndpoint is a lazy, one-liner version of `Session.Endpoint`.
@@ -244,20 +581,19 @@ func (session *Session) LazyEmit(key string, data interface{}) {
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
-//
-// 	endpoint := remitSession.LazyEndpoint("math.sum", sumHandler)
+//	remitSession := remit.Connect(...)
 //
-func (session *Session) LazyEndpoint(key string, handlers ...EndpointDataHandler) Endpoint {
+//	endpoint, err := remitSession.LazyEndpoint("math.sum", sumHandler)
+func (session *Session) LazyEndpoint(key string, handlers ...EndpointDataHandler) (Endpoint, error) {
 	if len(handlers) == 0 {
 		panic("No handlers given for lazy endpoint instantiation")
 	}
 
 	endpoint := session.Endpoint(key)
 	endpoint.OnData(handlers...)
-	endpoint.Open()
+	err := endpoint.Open()
 
-	return endpoint
+	return endpoint, err
 }
 
 // LazyListener is a lazy, one-liner version of `Listener.
@@ -271,20 +607,19 @@ func (session *Session) LazyEndpoint(key string, handlers ...EndpointDataHandler
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
+//	remitSession := remit.Connect(...)
 //
-// 	listener := remitSession.LazyListener("user.created", logUserDetails)
-//
-func (session *Session) LazyListener(key string, handlers ...EndpointDataHandler) Endpoint {
+//	listener, err := remitSession.LazyListener("user.created", logUserDetails)
+func (session *Session) LazyListener(key string, handlers ...EndpointDataHandler) (Endpoint, error) {
 	if len(handlers) == 0 {
 		panic("No handlers given for lazy listener instantiation")
 	}
 
 	listener := session.Listener(key)
 	listener.OnData(handlers...)
-	listener.Open()
+	err := listener.Open()
 
-	return listener
+	return listener, err
 }
 
 // LazyRequest is a lazy, one-liner version of `Session.Request`.
@@ -294,10 +629,9 @@ func (session *Session) LazyListener(key string, handlers ...EndpointDataHandler
 //
 // Example
 //
-// 	remitSession := remit.Connect(...)
-//
-// 	event := <-remitSession.LazyRequest("math.sum", remit.J{"numbers": []int{1, 5, 7}})
+//	remitSession := remit.Connect(...)
 //
+//	event := <-remitSession.LazyRequest("math.sum", remit.J{"numbers": []int{1, 5, 7}})
 func (session *Session) LazyRequest(key string, data interface{}) chan Event {
 	request := createRequest(session, RequestOptions{
 		RoutingKey: key,
@@ -306,6 +640,58 @@ func (session *Session) LazyRequest(key string, data interface{}) chan Event {
 	return request.Send(data)
 }
 
+// Listen subscribes `handler` to every message sent with the routing key `key`,
+// creating and consuming from a new exclusive queue straight away.
+//
+// Where endpoints and listeners created via `Session.Listener` share a queue
+// between every instance of a service, each call to `Listen` gets its own, so
+// all instances receive every message. This is useful for things like cache
+// invalidation, where every instance needs to react.
+//
+// The queue is deleted when the listener is closed or the connection is lost,
+// so messages sent whilst it isn't consuming are missed.
+//
+// Example:
+//
+//	remitSession := remit.Connect(...)
+//
+//	listener, err := remitSession.Listen("config.updated", reloadConfig)
+func (session *Session) Listen(key string, handler EndpointDataHandler) (Listener, error) {
+	return session.ListenWithOptions(ListenOptions{Event: key}, handler)
+}
+
+// ListenWithOptions subscribes `handler` like `Session.Listen`, using the
+// options described in the `ListenOptions` type.
+//
+// Example:
+//
+//	// every instance of the mailer sends each welcome email only once,
+//	// whilst every instance of other services still gets a copy
+//	listener, err := remitSession.ListenWithOptions(remit.ListenOptions{
+//		Event: "user.created",
+//		Group: "mailer",
+//	}, sendWelcomeEmail)
+func (session *Session) ListenWithOptions(options ListenOptions, handler EndpointDataHandler) (Listener, error) {
+	queue := options.Event + ":l:" + session.Config.Name + ":" + ulid.MustNew(ulid.Now(), nil).String()
+	if options.Group != "" {
+		queue = options.Event + ":l:" + options.Group
+	}
+
+	endpoint := createEndpoint(session, EndpointOptions{
+		RoutingKey:  options.Event,
+		Queue:       queue,
+		NonDurable:  true,
+		AutoDelete:  true,
+		Exclusive:   options.Group == "",
+		shouldReply: false,
+	})
+
+	endpoint.OnData(handler)
+	err := endpoint.Open()
+
+	return Listener{endpoint: &endpoint}, err
+}
+
 // Listener creates a listener for `key` but does not start consuming.
 // For a one-liner listener, see `Session.LazyListener`.
 //
@@ -323,12 +709,11 @@ func (session *Session) LazyRequest(key string, data interface{}) chan Event {
 //
 // Example:
 //
-// 	remitSession := remit.Connect(...)
-//
-// 	listener := remitSession.Listener("user.created")
-// 	listener.OnData(logUserDetails)
-// 	listener.Open()
+//	remitSession := remit.Connect(...)
 //
+//	listener := remitSession.Listener("user.created")
+//	listener.OnData(logUserDetails)
+//	listener.Open()
 func (session *Session) Listener(key string) Endpoint {
 	session.mu.Lock()
 	session.listenerCount = session.listenerCount + 1
@@ -344,6 +729,149 @@ func (session *Session) Listener(key string) Endpoint {
 	return listener
 }
 
+// Ping checks that the connection to RabbitMQ is healthy by making sure every
+// publish channel is open, then opening a temporary channel and checking that
+// `Config.Exchange` exists, returning an error if any of these fail or `ctx`
+// is done first.
+//
+// This is useful for readiness and liveness probes:
+//
+//	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+//		err := remitSession.Ping(r.Context())
+//		if err != nil {
+//			w.WriteHeader(http.StatusServiceUnavailable)
+//		}
+//	})
+func (session *Session) Ping(ctx context.Context) error {
+	conn := session.connection.get()
+	if conn.IsClosed() {
+		return amqp.ErrClosed
+	}
+
+	err := session.publishers.check()
+	if err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		channel, err := conn.Channel()
+		if err != nil {
+			result <- err
+			return
+		}
+		defer channel.Close()
+
+		result <- channel.ExchangeDeclarePassive(
+			session.Config.Exchange,     // name of the exchange
+			session.Config.ExchangeType, // type
+			true,                        // durable
+			true,                        // autoDelete
+			false,                       // internal
+			false,                       // noWait
+			nil,                         // arguments
+		)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publish publishes `data` to `exchange` using `key` as the routing key,
+// returning any error encountered whilst publishing.
+//
+// Unlike `Session.LazyEmit`, the exchange is given rather than always being
+// `Config.Exchange`, and the message isn't necessarily encoded the way Remit
+// would expect, making this useful for sending to consumers outside of Remit.
+// For the same reason, it's never compressed or encrypted, regardless of
+// `ConnectionOptions.CompressThreshold` or `ConnectionOptions.Encryptor`.
+// An empty `exchange` publishes directly to the queue named `key`. Messages
+// published to `Config.Exchange` are still validated against
+// `ConnectionOptions.Schemas`.
+//
+// The exchange must already exist; Remit doesn't declare it.
+//
+// Example:
+//
+//	remitSession := remit.Connect(...)
+//
+//	err := remitSession.Publish("audit", "user.deleted", b, remit.PublishOptions{
+//		ContentType: "application/x-protobuf",
+//		Persistent:  true,
+//	})
+func (session *Session) Publish(exchange string, key string, data interface{}, options PublishOptions) error {
+	err := session.hold(1)
+	if err != nil {
+		return err
+	}
+	defer session.release()
+
+	ctx, endSpan := session.Config.Tracer.StartSpan(context.Background(), SpanKindProducer, key)
+
+	message, err := session.publishing(ctx, data, options)
+	if err == nil && exchange == session.Config.Exchange {
+		err = session.validate(key, message.Body, session.Config.Serializer)
+	}
+	if err == nil {
+		err = session.publishers.publishRaw(
+			exchange, // exchange
+			key,      // routing key / queue
+			message,  // amqp.Publishing
+		)
+	}
+
+	endSpan(err)
+
+	return err
+}
+
+// publishing builds the message `Session.Publish` sends for `data`.
+func (session *Session) publishing(ctx context.Context, data interface{}, options PublishOptions) (amqp.Publishing, error) {
+	headers := amqp.Table{}
+	for k, v := range options.Headers {
+		headers[k] = v
+	}
+	session.Config.Propagator.Inject(ctx, headers)
+
+	message := amqp.Publishing{
+		Headers:   headers,
+		Timestamp: time.Now(),
+		MessageId: ulid.MustNew(ulid.Now(), nil).String(),
+		AppId:     session.Config.Name,
+		Priority:  options.Priority,
+	}
+
+	if b, ok := data.([]byte); ok {
+		message.Body = b
+	} else if data != nil {
+		body, contentType, err := session.Config.Serializer.Marshal(data)
+		if err != nil {
+			return amqp.Publishing{}, err
+		}
+		message.Body = body
+		message.ContentType = contentType
+	}
+
+	if options.ContentType != "" {
+		message.ContentType = options.ContentType
+	}
+
+	if options.Persistent {
+		message.DeliveryMode = amqp.Persistent
+	}
+
+	if options.Expiration > 0 {
+		message.Expiration = expiration(options.Expiration)
+	}
+
+	return message, nil
+}
+
 // Request creates a request with the routing key of `key` but does not
 // immediately send.
 // For a one-liner request, see `Session.LazyRequest`.
@@ -352,13 +880,12 @@ func (session *Session) Listener(key string) Endpoint {
 // Only a single event will be returned for each request made.
 // A synchronous pattern for this would be:
 //
-// 	request := remitSession.Request("math.sum")
-// 	event := <-request.Send(remit.J{"numbers": []int{1, 5, 7}})
+//	request := remitSession.Request("math.sum")
+//	event := <-request.Send(remit.J{"numbers": []int{1, 5, 7}})
 //
 // This would be synonymous with `Session.LazyRequest`'s:
 //
-// 	event := <-remitSession.LazyRequest("math.sum", remit.J{"numbers": []int{1, 5, 7}})
-//
+//	event := <-remitSession.LazyRequest("math.sum", remit.J{"numbers": []int{1, 5, 7}})
 func (session *Session) Request(key string) Request {
 	request := createRequest(session, RequestOptions{
 		RoutingKey: key,
@@ -367,46 +894,441 @@ func (session *Session) Request(key string) Request {
 	return request
 }
 
+// RequestAll sends a request to every responder bound to `key` and gathers
+// their replies, as set by `options`. See `Request.SendAll` for details.
+//
+// Example:
+//
+//	events, err := remitSession.RequestAll(ctx, "inventory.stock", remit.J{"sku": sku}, remit.GatherOptions{
+//		Replies: 3,
+//		Window:  time.Second,
+//	})
+func (session *Session) RequestAll(ctx context.Context, key string, data interface{}, options GatherOptions) ([]Event, error) {
+	request := session.Request(key)
+
+	return request.SendAll(ctx, data, options)
+}
+
+// RequestWithOptions creates a request like `Session.Request`, using the options
+// described in the `RequestOptions` type.
+//
+// Example:
+//
+//	request := remitSession.RequestWithOptions(remit.RequestOptions{
+//		RoutingKey: "price.quote",
+//		Expiration: 5 * time.Second,
+//	})
+func (session *Session) RequestWithOptions(options RequestOptions) Request {
+	return createRequest(session, options)
+}
+
+// Use adds middleware that wraps every handler run by the session's endpoints
+// and listeners, including those already registered. Middleware runs in the
+// order it's added, with the first added being outermost.
+//
+// Middleware can stop a message reaching a handler by sending to
+// `Event.Failure` (or `Event.Success`) without calling `next`.
+//
+// Example:
+//
+//	remitSession.Use(func(next remit.EndpointDataHandler) remit.EndpointDataHandler {
+//		return func(event remit.Event) {
+//			if event.Headers()["x-api-key"] != key {
+//				event.Failure <- remit.RemitError{Code: "unauthorized", Message: "bad API key"}
+//				return
+//			}
+//
+//			next(event)
+//		}
+//	})
+func (session *Session) Use(middleware ...Middleware) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	*session.middleware = append(*session.middleware, middleware...)
+}
+
+// wrap applies all middleware added via `Session.Use` to `handler`.
+func (session *Session) wrap(handler EndpointDataHandler) EndpointDataHandler {
+	session.mu.Lock()
+	middleware := *session.middleware
+	session.mu.Unlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+// delayedExchange returns the name of the exchange used for delayed messages,
+// declaring it if it hasn't been already.
+func (session *Session) delayedExchange() (string, error) {
+	name := session.Config.Exchange + ".delayed"
+
+	session.mu.Lock()
+	declared := session.exchanges[name]
+	session.mu.Unlock()
+
+	if declared {
+		return name, nil
+	}
+
+	workChannel, err := session.workerPool.get()
+	if err != nil {
+		return "", err
+	}
+
+	err = session.declareExchange(workChannel, name, "x-delayed-message", amqp.Table{
+		"x-delayed-type": session.Config.ExchangeType,
+	})
+	if err != nil {
+		session.workerPool.drop(workChannel)
+		return "", fmt.Errorf("failed to declare delayed exchange %q; is the rabbitmq_delayed_message_exchange plugin enabled? %s", name, err)
+	}
+
+	// route every delayed message on to the main exchange once it's due
+	err = workChannel.ExchangeBind(
+		session.Config.Exchange, // destination
+		"#",                     // routing key
+		name,                    // source
+		false,                   // noWait
+		nil,                     // arguments
+	)
+	if err != nil {
+		session.workerPool.drop(workChannel)
+		return "", fmt.Errorf("failed to bind delayed exchange %q: %s", name, err)
+	}
+
+	session.workerPool.release(workChannel)
+
+	session.mu.Lock()
+	session.exchanges[name] = true
+	session.mu.Unlock()
+
+	return name, nil
+}
+
+// delayQueue returns the name of the queue used to delay messages for `key`
+// by `delay` when `Config.DelayWithTTL` is set, declaring it so that it
+// doesn't expire before the message is due.
+func (session *Session) delayQueue(key string, delay time.Duration) (string, error) {
+	ms := int64(delay / time.Millisecond)
+	name := fmt.Sprintf("%s.delay.%d.%s", session.Config.Exchange, ms, key)
+
+	workChannel, err := session.workerPool.get()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = workChannel.QueueDeclare(
+		name,  // name of the queue
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		amqp.Table{
+			"x-message-ttl":             ms,
+			"x-expires":                 ms + int64(time.Minute/time.Millisecond),
+			"x-dead-letter-exchange":    session.Config.Exchange,
+			"x-dead-letter-routing-key": key,
+		}, // arguments
+	)
+	if err != nil {
+		session.workerPool.drop(workChannel)
+		return "", fmt.Errorf("failed to declare delay queue %q: %s", name, err)
+	}
+
+	session.workerPool.release(workChannel)
+
+	return name, nil
+}
+
+// replyQueueExists returns whether the reply queue `name` still exists,
+// checking with the broker at most once every `Config.ReplyCheckTTL`.
+//
+// An error is only returned if the check couldn't be made at all.
+func (session *Session) replyQueueExists(name string) (bool, error) {
+	if session.replyQueues.Seen(name) {
+		return true, nil
+	}
+
+	workChannel, err := session.workerPool.get()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = workChannel.QueueDeclarePassive(
+		name,  // the queue to assert
+		false, // durable
+		true,  // autoDelete
+		true,  // exclusive
+		false, // noWait
+		nil,   // arguments
+	)
+	if err != nil {
+		session.workerPool.drop(workChannel)
+		session.Config.Logger.Debug("Reply queue check failed", "replyTo", name, "error", err)
+		return false, nil
+	}
+
+	session.workerPool.release(workChannel)
+
+	if session.Config.ReplyCheckTTL > 0 {
+		session.replyQueues.Mark(name, session.Config.ReplyCheckTTL)
+	}
+
+	return true, nil
+}
+
+// declareExchange declares an exchange with the durability set in `Config`.
+func (session *Session) declareExchange(channel Channel, name string, kind string, args amqp.Table) error {
+	return channel.ExchangeDeclare(
+		name,                                 // name of the exchange
+		kind,                                 // type
+		!session.Config.ExchangeNonDurable,   // durable
+		!session.Config.ExchangeNoAutoDelete, // autoDelete
+		false,                                // internal
+		false,                                // noWait
+		args,                                 // arguments
+	)
+}
+
+// hold adds `n` to the session's wait group, failing with `ErrSessionClosed`
+// if the session is closing and nothing is left for `Session.Close` to wait
+// for, as adding to the wait group then would race its `Wait`.
+func (session *Session) hold(n int) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if *session.closing && *session.pending == 0 {
+		return ErrSessionClosed
+	}
+
+	*session.pending += n
+	session.waitGroup.Add(n)
+
+	return nil
+}
+
+// release marks one call counted by `hold` as done.
+func (session *Session) release() {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	*session.pending--
+	session.waitGroup.Done()
+}
+
+// trackEndpoint records `endpoint` as open, replacing any other copy of it
+// tracked before, so that it's the one restored after reconnecting.
+func (session *Session) trackEndpoint(endpoint *Endpoint) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	tracked := *endpoint
+	session.endpoints[endpoint.state] = &tracked
+}
+
+func (session *Session) untrackEndpoint(endpoint *Endpoint) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	delete(session.endpoints, endpoint.state)
+}
+
 func (session *Session) registerReply(correlationId string, returnChannel chan Event) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
 	session.awaitingReply[correlationId] = returnChannel
 }
 
+func (session *Session) unregisterReply(correlationId string) chan Event {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	returnChannel := session.awaitingReply[correlationId]
+	delete(session.awaitingReply, correlationId)
+	delete(session.progress, correlationId)
+	delete(session.gathering, correlationId)
+
+	return returnChannel
+}
+
+func (session *Session) registerProgress(correlationId string, progress func(Event)) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.progress[correlationId] = progress
+}
+
+func (session *Session) registerGather(correlationId string, onReply func(Event)) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.gathering[correlationId] = onReply
+}
+
 func (session *Session) watchForReplies(replies <-chan amqp.Delivery) {
 	for reply := range replies {
-		returnChannel := session.awaitingReply[reply.CorrelationId]
+		// progress updates leave the request waiting for its final reply
+		if reply.Headers[progressHeader] == true {
+			session.mu.Lock()
+			progress := session.progress[reply.CorrelationId]
+			session.mu.Unlock()
+
+			if progress != nil {
+				progress(session.replyEvent(reply))
+			}
 
-		if returnChannel == nil {
 			continue
 		}
 
-		delete(session.awaitingReply, reply.CorrelationId)
-
-		var parsedData []EventData
-		err := json.Unmarshal(reply.Body, &parsedData)
-		failOnError(err, "Failed to parse JSON for reply")
+		// requests sent via `Session.RequestAll` accept many replies
+		session.mu.Lock()
+		gather := session.gathering[reply.CorrelationId]
+		session.mu.Unlock()
 
-		event := Event{
-			EventId:   reply.MessageId,
-			EventType: reply.RoutingKey,
-			Resource:  reply.AppId,
-			message:   reply,
+		if gather != nil {
+			gather(session.replyEvent(reply))
+			continue
 		}
 
-		if parsedData[0] != nil {
-			event.Error = parsedData[0]
-		} else {
-			event.Data = parsedData[1]
+		returnChannel := session.unregisterReply(reply.CorrelationId)
+
+		if returnChannel == nil {
+			continue
 		}
 
 		select {
-		case returnChannel <- event:
+		case returnChannel <- session.replyEvent(reply):
 		default:
 		}
 	}
 }
 
-func logClosure() {
-	log.Println("Initiated Remit closure.")
-	log.Println("  [x] Warm shutdown - resolving pending tasks before closing...")
-	log.Println("      Cancelling again will initiate a cold shutdown and messages may be lost.")
+// messageBody returns the body of `d` as it was before being encrypted and
+// compressed for publishing.
+func (session *Session) messageBody(d amqp.Delivery) ([]byte, error) {
+	body, err := decrypt(d, session.Config.Decryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompress(body, d.ContentEncoding, session.Config.Compressors)
+}
+
+// replyEvent decodes a reply in to an `Event`.
+func (session *Session) replyEvent(reply amqp.Delivery) Event {
+	serializer := session.serializerFor(reply.ContentType)
+
+	event := Event{
+		EventId:   reply.MessageId,
+		EventType: reply.RoutingKey,
+		Resource:  reply.AppId,
+
+		message:         reply,
+		serializer:      serializer,
+		acknowledgement: newAcknowledgement(true),
+	}
+
+	// replies are sent as an `[err, result]` pair unless raw
+	var parsedData []interface{}
+	body, err := session.messageBody(reply)
+	if err == nil && reply.Headers[rawReplyHeader] == true {
+		event.Body = body
+	} else if err == nil {
+		err = serializer.Unmarshal(body, &parsedData)
+	}
+	if err == nil && len(parsedData) > 0 && parsedData[0] != nil {
+		event.Error = decodeRemitError(serializer, parsedData[0])
+	} else if err == nil && len(parsedData) > 1 && parsedData[1] != nil {
+		event.Body, err = decodeEventData(serializer, parsedData[1], &event.Data)
+	}
+
+	if err != nil {
+		session.Config.Logger.Warn("Failed to parse reply", "routingKey", reply.RoutingKey, "messageId", reply.MessageId, "error", err)
+		event.Error = err.Error()
+	}
+
+	return event
+}
+
+// serializerFor returns the serializer for `contentType`, falling back to
+// `Config.Serializer`.
+func (session *Session) serializerFor(contentType string) Serializer {
+	if serializer, ok := session.Config.Serializers[contentType]; ok {
+		return serializer
+	}
+
+	return session.Config.Serializer
+}
+
+// decodeEventData re-encodes an already-decoded value so that it can be
+// decoded as `EventData` regardless of the serializer in use, returning the
+// re-encoded body.
+func decodeEventData(serializer Serializer, v interface{}, data *EventData) ([]byte, error) {
+	b, _, err := serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, serializer.Unmarshal(b, data)
+}
+
+// decodeRemitError turns the error half of a reply back in to a `RemitError`.
+// Plain strings, as sent by older versions of Remit, become the `Message`.
+func decodeRemitError(serializer Serializer, v interface{}) RemitError {
+	if s, ok := v.(string); ok {
+		return RemitError{Message: s}
+	}
+
+	var remitErr RemitError
+	b, _, err := serializer.Marshal(v)
+	if err == nil {
+		err = serializer.Unmarshal(b, &remitErr)
+	}
+	if err != nil || remitErr.Message == "" {
+		return RemitError{Message: fmt.Sprint(v), Details: v}
+	}
+
+	return remitErr
+}
+
+// handleReturn deals with a message the broker couldn't route.
+func (session *Session) handleReturn(ret amqp.Return) {
+	session.Config.Logger.Warn("Message returned as unroutable", "exchange", ret.Exchange, "routingKey", ret.RoutingKey, "messageId", ret.MessageId, "reason", ret.ReplyText)
+
+	if ret.CorrelationId != "" {
+		if returnChannel := session.unregisterReply(ret.CorrelationId); returnChannel != nil {
+			select {
+			case returnChannel <- Event{
+				EventType: ret.RoutingKey,
+				Error:     RemitError{Code: "unroutable", Message: ret.ReplyText},
+
+				acknowledgement: newAcknowledgement(true),
+			}:
+			default:
+			}
+		}
+	}
+
+	if session.Config.OnReturn != nil {
+		session.Config.OnReturn(ret)
+	}
+}
+
+// reportError logs `err` and passes it on to `Config.OnError`, if set.
+func (session *Session) reportError(msg string, err error, fields ...interface{}) {
+	session.Config.Logger.Error(msg, append(fields, "error", err)...)
+
+	if session.Config.OnError != nil {
+		session.Config.OnError(err)
+	}
+}
+
+func (session *Session) logClosure() {
+	session.Config.Logger.Info("Warm shutdown - resolving pending tasks before closing...")
+	session.Config.Logger.Info("Cancelling again will initiate a cold shutdown and messages may be lost.")
 }
@@ -0,0 +1,61 @@
+package remit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionClose(t *testing.T) {
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}})
+
+	started := make(chan bool)
+	emitted := make(chan error, 1)
+	_, err := session.LazyEndpoint("close.me", func(event Event) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+
+		// handlers still running can emit whilst the session closes
+		emitted <- session.LazyEmit("closing", J{})
+
+		event.Success <- nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.LazyEmit("close.me", J{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = session.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = <-emitted
+	if err != nil {
+		t.Errorf("emitting from a handler whilst closing: %v", err)
+	}
+
+	err = session.LazyEmit("closed", J{})
+	if err != ErrSessionClosed {
+		t.Errorf("emitting once closed: got %v, want %v", err, ErrSessionClosed)
+	}
+
+	request := session.Request("closed")
+	_, err = request.SendContext(ctx, J{})
+	if err != ErrSessionClosed {
+		t.Errorf("requesting once closed: got %v, want %v", err, ErrSessionClosed)
+	}
+
+	err = session.Publish("", "closed", []byte("body"), PublishOptions{})
+	if err != ErrSessionClosed {
+		t.Errorf("publishing once closed: got %v, want %v", err, ErrSessionClosed)
+	}
+}
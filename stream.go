@@ -0,0 +1,216 @@
+package remit
+
+import (
+	"context"
+	"sync"
+)
+
+// Stream sends the reply to an event as a series of chunks, for results too
+// large to send as a single message. It's created using `Event.Stream`.
+//
+// Chunks are sent as they're given and received by requesters using
+// `Request.Stream`. Every chunk and the final reply are published on the same
+// channel, so they arrive in the order they were sent. Once every chunk has
+// been sent, `Stream.Close` finishes handling the event. To fail part way
+// through, send to `Event.Failure` instead of closing the stream.
+//
+// 	stream := event.Stream()
+//
+// 	for rows.Next() {
+// 		...
+// 		err := stream.Send(row)
+// 		if err != nil {
+// 			event.Failure <- err
+// 			return
+// 		}
+// 	}
+//
+// 	stream.Close()
+//
+type Stream struct {
+	event Event
+	once  *sync.Once
+}
+
+// Stream returns a `Stream` for replying to the event in chunks.
+//
+// Chunks are sent the same way as `Event.Progress` updates, so like them are
+// discarded if the event won't be replied to.
+func (event Event) Stream() Stream {
+	return Stream{
+		event: event,
+		once:  &sync.Once{},
+	}
+}
+
+// Send publishes `chunk` to the requester, returning once it's been sent.
+func (stream Stream) Send(chunk interface{}) error {
+	return stream.event.Progress(chunk)
+}
+
+// Close finishes the stream by sending an empty final reply, after which
+// nothing more should be sent for the event. Calling it again does nothing.
+func (stream Stream) Close() {
+	stream.once.Do(func() {
+		stream.event.Success <- nil
+	})
+}
+
+// ReplyStream receives the chunks of a reply sent using `Event.Stream`. It's
+// returned by `Request.Stream` and read much like `sql.Rows`:
+//
+// 	stream, err := request.Stream(ctx, remit.J{"report": "orders"})
+// 	if err != nil {
+// 		return err
+// 	}
+// 	defer stream.Close()
+//
+// 	for stream.Next() {
+// 		chunk := stream.Event()
+// 		...
+// 	}
+//
+// 	if err := stream.Err(); err != nil {
+// 		return err
+// 	}
+//
+// Chunks are buffered as they arrive, so no chunk is ever dropped regardless
+// of how slowly they're read, and reading them never holds up replies to
+// other requests.
+type ReplyStream struct {
+	mu      *sync.Mutex
+	pending []Event
+	current Event
+	done    bool
+	closed  bool
+	err     error
+	notify  chan bool
+	cancel  context.CancelFunc
+}
+
+// Stream sends some data just like `Request.SendContext`, returning a
+// `ReplyStream` of the chunks the handler replies with using `Event.Stream`.
+//
+// The stream finishes once the handler sends its final reply, or when `ctx`
+// is done or the request's `Timeout` passes, which stops it waiting for any
+// more chunks.
+func (request *Request) Stream(ctx context.Context, data interface{}) (*ReplyStream, error) {
+	var cancel context.CancelFunc
+	if request.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, request.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	stream := &ReplyStream{
+		mu:     &sync.Mutex{},
+		notify: make(chan bool, 1),
+		cancel: cancel,
+	}
+
+	receiveChannel := make(chan Event, 1)
+	messageId, err := request.publish(ctx, data, receiveChannel, stream.push, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case event := <-receiveChannel:
+			stream.finish(event.Err())
+		case <-ctx.Done():
+			request.session.unregisterReply(messageId)
+			stream.finish(ctx.Err())
+		}
+
+		cancel()
+	}()
+
+	return stream, nil
+}
+
+// Next waits for the next chunk, returning false once the stream has
+// finished and every chunk has been read. The chunk is then available via
+// `ReplyStream.Event`.
+func (stream *ReplyStream) Next() bool {
+	for {
+		stream.mu.Lock()
+		if len(stream.pending) > 0 {
+			stream.current = stream.pending[0]
+			stream.pending = stream.pending[1:]
+			stream.mu.Unlock()
+
+			return true
+		}
+
+		done := stream.done
+		stream.mu.Unlock()
+
+		if done {
+			return false
+		}
+
+		<-stream.notify
+	}
+}
+
+// Event returns the chunk read by the last call to `ReplyStream.Next`.
+func (stream *ReplyStream) Event() Event {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	return stream.current
+}
+
+// Err returns the error the stream finished with, which is the failure
+// replied by the handler or the reason it stopped waiting, if any.
+func (stream *ReplyStream) Err() error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	return stream.err
+}
+
+// Close stops waiting for any more chunks. It's safe to call more than once
+// and after the stream has finished.
+func (stream *ReplyStream) Close() {
+	stream.mu.Lock()
+	stream.closed = true
+	stream.mu.Unlock()
+
+	stream.cancel()
+}
+
+// push buffers `chunk` to be read. Chunks always arrive before the final
+// reply, so the only ones dropped are those arriving after the stream has
+// stopped waiting because of its timeout or context.
+func (stream *ReplyStream) push(chunk Event) {
+	stream.mu.Lock()
+	if !stream.done {
+		stream.pending = append(stream.pending, chunk)
+	}
+	stream.mu.Unlock()
+
+	stream.wake()
+}
+
+func (stream *ReplyStream) finish(err error) {
+	stream.mu.Lock()
+	if stream.closed && err == context.Canceled {
+		// closed by the reader, rather than failing
+		err = nil
+	}
+	stream.done = true
+	stream.err = err
+	stream.mu.Unlock()
+
+	stream.wake()
+}
+
+func (stream *ReplyStream) wake() {
+	select {
+	case stream.notify <- true:
+	default:
+	}
+}
@@ -0,0 +1,66 @@
+package remit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}})
+	defer session.Close(context.Background())
+
+	_, err := session.LazyEndpoint("report.rows", func(event Event) {
+		stream := event.Stream()
+		for i := 1; i <= int(event.Data["rows"].(float64)); i++ {
+			stream.Send(J{"row": i})
+		}
+
+		if event.Data["fail"] == true {
+			event.Failure <- RemitError{Code: "report_failed", Message: "no more rows"}
+			return
+		}
+
+		stream.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    J
+		wantErr bool
+	}{
+		{"finished", J{"rows": 5}, false},
+		{"empty", J{"rows": 0}, false},
+		{"failed part way", J{"rows": 2, "fail": true}, true},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		request := session.Request("report.rows")
+		stream, err := request.Stream(ctx, test.data)
+		if err != nil {
+			cancel()
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		rows := 0
+		for stream.Next() {
+			rows++
+			if row := stream.Event().Data["row"]; row != float64(rows) {
+				t.Errorf("%s: got row %v, want %d", test.name, row, rows)
+			}
+		}
+		stream.Close()
+		cancel()
+
+		if rows != test.data["rows"] {
+			t.Errorf("%s: got %d rows, want %v", test.name, rows, test.data["rows"])
+		}
+		if (stream.Err() != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error = %v", test.name, stream.Err(), test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package remit
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
+
+// Propagator injects trace context in to the headers of outgoing messages and
+// extracts it from the headers of incoming ones, associating the request made
+// by one service with the handling of it by another.
+//
+// The default is `TraceContextPropagator`. To use OpenTelemetry, wrap its
+// propagator using `HeadersCarrier`:
+//
+// 	type otelPropagator struct{ p propagation.TextMapPropagator }
+//
+// 	func (o otelPropagator) Inject(ctx context.Context, headers amqp.Table) {
+// 		o.p.Inject(ctx, remit.HeadersCarrier(headers))
+// 	}
+//
+// 	func (o otelPropagator) Extract(ctx context.Context, headers amqp.Table) context.Context {
+// 		return o.p.Extract(ctx, remit.HeadersCarrier(headers))
+// 	}
+//
+type Propagator interface {
+	Inject(ctx context.Context, headers amqp.Table)
+	Extract(ctx context.Context, headers amqp.Table) context.Context
+}
+
+// HeadersCarrier adapts AMQP headers so that they can be used as a carrier
+// for trace propagation, such as OpenTelemetry's `TextMapCarrier`.
+type HeadersCarrier amqp.Table
+
+// Get returns the value of the header `key`, or an empty string.
+func (c HeadersCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+
+	return value
+}
+
+// Set sets the header `key` to `value`.
+func (c HeadersCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+// Keys returns the names of all headers.
+func (c HeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// TraceContext is a W3C trace context, as carried by the `traceparent` and
+// `tracestate` headers.
+//
+// See https://www.w3.org/TR/trace-context/ for details.
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of `ctx` carrying `tc`, which will be
+// propagated by `TraceContextPropagator` on any message published with it.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the trace context carried by `ctx`, if any.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+
+	return tc, ok
+}
+
+// TraceContextPropagator is the default `Propagator`, passing W3C trace context
+// headers from incoming messages on to any published in the same context.
+type TraceContextPropagator struct{}
+
+// Inject sets the `traceparent` and `tracestate` headers from `ctx`.
+func (TraceContextPropagator) Inject(ctx context.Context, headers amqp.Table) {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok || tc.TraceParent == "" {
+		return
+	}
+
+	carrier := HeadersCarrier(headers)
+	carrier.Set("traceparent", tc.TraceParent)
+
+	if tc.TraceState != "" {
+		carrier.Set("tracestate", tc.TraceState)
+	}
+}
+
+// Extract returns a copy of `ctx` carrying the `traceparent` and `tracestate`
+// headers, if present.
+func (TraceContextPropagator) Extract(ctx context.Context, headers amqp.Table) context.Context {
+	carrier := HeadersCarrier(headers)
+
+	tc := TraceContext{
+		TraceParent: carrier.Get("traceparent"),
+		TraceState:  carrier.Get("tracestate"),
+	}
+
+	if tc.TraceParent == "" {
+		return ctx
+	}
+
+	return ContextWithTraceContext(ctx, tc)
+}
+
+// SpanKind is the role a span plays in passing a message between services.
+type SpanKind int
+
+const (
+	// SpanKindProducer is used for spans covering the publishing of a
+	// request or emission.
+	SpanKindProducer SpanKind = iota
+
+	// SpanKindConsumer is used for spans covering the handling of a message
+	// received by an endpoint or listener.
+	SpanKindConsumer
+)
+
+// Tracer creates spans for the messages Remit publishes and handles.
+//
+// `StartSpan` returns a copy of `ctx` carrying the new span, which is then
+// passed to the `Propagator` so that the span is the parent of any on the
+// other side, along with a function to end the span with the error the
+// message failed with, if any.
+//
+// The default is `NopTracer`. To create OpenTelemetry spans, use a
+// `Propagator` like the one described there alongside:
+//
+// 	type otelTracer struct{ t trace.Tracer }
+//
+// 	func (o otelTracer) StartSpan(ctx context.Context, kind remit.SpanKind, routingKey string) (context.Context, func(error)) {
+// 		spanKind := trace.SpanKindProducer
+// 		if kind == remit.SpanKindConsumer {
+// 			spanKind = trace.SpanKindConsumer
+// 		}
+//
+// 		ctx, span := o.t.Start(ctx, routingKey, trace.WithSpanKind(spanKind))
+//
+// 		return ctx, func(err error) {
+// 			if err != nil {
+// 				span.RecordError(err)
+// 				span.SetStatus(codes.Error, err.Error())
+// 			}
+// 			span.End()
+// 		}
+// 	}
+//
+type Tracer interface {
+	StartSpan(ctx context.Context, kind SpanKind, routingKey string) (context.Context, func(error))
+}
+
+// NopTracer is a `Tracer` that creates no spans.
+type NopTracer struct{}
+
+// StartSpan returns `ctx` as-is.
+func (NopTracer) StartSpan(ctx context.Context, kind SpanKind, routingKey string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
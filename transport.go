@@ -0,0 +1,76 @@
+package remit
+
+import "github.com/streadway/amqp"
+
+// Transport connects Remit to a message broker. The default, `AMQPTransport`,
+// connects to RabbitMQ; `MemoryTransport` routes messages in memory, which is
+// useful for testing handlers without a broker.
+//
+// The interfaces here mirror the parts of `github.com/streadway/amqp` that
+// Remit uses, so that `*amqp.Channel` is itself a `Channel`.
+type Transport interface {
+	Dial(url string, config amqp.Config) (Connection, error)
+}
+
+// Connection is a connection to a broker, opened by a `Transport`.
+type Connection interface {
+	Channel() (Channel, error)
+	Close() error
+	IsClosed() bool
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+}
+
+// Channel is a channel opened on a `Connection`.
+type Channel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	Cancel(consumer string, noWait bool) error
+	Close() error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Confirm(noWait bool) error
+	Tx() error
+	TxCommit() error
+	TxRollback() error
+
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeBind(destination, key, source string, noWait bool, args amqp.Table) error
+
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(returns chan amqp.Return) chan amqp.Return
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	NotifyCancel(receiver chan string) chan string
+}
+
+// AMQPTransport is the default `Transport`, connecting to RabbitMQ using
+// `github.com/streadway/amqp`.
+type AMQPTransport struct{}
+
+// Dial connects to the RabbitMQ instance at `url`.
+func (AMQPTransport) Dial(url string, config amqp.Config) (Connection, error) {
+	conn, err := amqp.DialConfig(url, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return amqpConnection{conn}, nil
+}
+
+// amqpConnection adapts `*amqp.Connection`, whose `Channel` method returns
+// the concrete channel type, to `Connection`.
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (conn amqpConnection) Channel() (Channel, error) {
+	channel, err := conn.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
@@ -0,0 +1,150 @@
+package remit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// Tx groups messages so that either all or none of them are delivered,
+// created using `Session.Tx`.
+//
+// Messages published through a Tx are held by the broker until
+// `Tx.Commit` is called, or discarded by `Tx.Rollback`. A Tx can only be
+// committed or rolled back once, after which it must not be used again.
+type Tx struct {
+	session *Session
+	channel Channel
+
+	mu   *sync.Mutex
+	done bool
+}
+
+// Tx starts a transaction on a channel of its own, so that a set of
+// emissions can be published as a unit.
+//
+// This is useful for only sending events once other work, such as a database
+// commit, has succeeded:
+//
+// 	tx, err := remitSession.Tx()
+// 	if err != nil {
+// 		return err
+// 	}
+//
+// 	tx.Emit("user.created", user)
+// 	tx.Emit("welcome.queued", remit.J{"id": user.Id})
+//
+// 	if err := db.Commit(); err != nil {
+// 		tx.Rollback()
+// 		return err
+// 	}
+//
+// 	return tx.Commit()
+//
+// The transaction's channel doesn't use `ConnectionOptions.Confirm`, as a
+// successful commit already means the broker has accepted every message.
+func (session *Session) Tx() (*Tx, error) {
+	channel, err := session.connection.get().Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = channel.Tx()
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	return &Tx{
+		session: session,
+		channel: channel,
+		mu:      &sync.Mutex{},
+	}, nil
+}
+
+// Emit adds an emission of `data` with the routing key `key` to the
+// transaction, to be delivered when it's committed.
+func (tx *Tx) Emit(key string, data interface{}) error {
+	return tx.publish(tx.session.Config.Exchange, key, data, PublishOptions{}, true)
+}
+
+// Publish adds a message to the transaction just like `Session.Publish`, to be
+// delivered when it's committed.
+func (tx *Tx) Publish(exchange string, key string, data interface{}, options PublishOptions) error {
+	return tx.publish(exchange, key, data, options, false)
+}
+
+// publish adds a message to the transaction, compressing and encrypting it as
+// configured if `encode` is set.
+func (tx *Tx) publish(exchange string, key string, data interface{}, options PublishOptions, encode bool) error {
+	message, err := tx.session.publishing(context.Background(), data, options)
+	if err != nil {
+		return err
+	}
+
+	if exchange == tx.session.Config.Exchange {
+		err = tx.session.validate(key, message.Body, tx.session.Config.Serializer)
+		if err != nil {
+			return err
+		}
+	}
+
+	intercept(tx.session.Config.PublishInterceptors, exchange, key, &message)
+
+	if encode {
+		err = compress(&message, tx.session.Config.CompressThreshold, tx.session.Config.Compressor)
+		if err != nil {
+			return err
+		}
+
+		err = encrypt(&message, tx.session.Config.Encryptor)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	return tx.channel.Publish(
+		exchange, // exchange
+		key,      // routing key / queue
+		false,    // mandatory
+		false,    // immediate
+		message,  // amqp.Publishing
+	)
+}
+
+// Commit delivers every message published in the transaction.
+func (tx *Tx) Commit() error {
+	return tx.finish(tx.channel.TxCommit)
+}
+
+// Rollback discards every message published in the transaction.
+func (tx *Tx) Rollback() error {
+	return tx.finish(tx.channel.TxRollback)
+}
+
+func (tx *Tx) finish(end func() error) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	err := end()
+
+	closeErr := tx.channel.Close()
+	if err == nil && closeErr != amqp.ErrClosed {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,76 @@
+package remit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// received returns the routing keys of the events that arrive on `events`
+// until none has arrived for a short while.
+func received(events <-chan string) []string {
+	var keys []string
+
+	for {
+		select {
+		case key := <-events:
+			keys = append(keys, key)
+		case <-time.After(100 * time.Millisecond):
+			return keys
+		}
+	}
+}
+
+func TestTx(t *testing.T) {
+	session := Connect(ConnectionOptions{Name: "test", Transport: NewMemoryTransport(), Logger: NopLogger{}})
+	defer session.Close(context.Background())
+
+	events := make(chan string, 10)
+	_, err := session.Listen("tx.#", func(event Event) {
+		events <- event.EventType
+		event.Success <- nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		finish func(tx *Tx) error
+		want   int
+	}{
+		{"commit", (*Tx).Commit, 2},
+		{"rollback", (*Tx).Rollback, 0},
+	}
+
+	for _, test := range tests {
+		tx, err := session.Tx()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{"tx.one", "tx.two"} {
+			err = tx.Emit(key, J{"test": test.name})
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+
+		if keys := received(events); len(keys) != 0 {
+			t.Errorf("%s: got %v before the transaction finished", test.name, keys)
+		}
+
+		err = test.finish(tx)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if keys := received(events); len(keys) != test.want {
+			t.Errorf("%s: got %v, want %d events", test.name, keys, test.want)
+		}
+
+		if test.finish(tx) != ErrTxDone {
+			t.Errorf("%s: finished the transaction twice", test.name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package remit
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoData is returned by `Bind` when the event has no data to decode.
+var ErrNoData = errors.New("remit: event has no data to decode")
+
+// Bind decodes the data of `event` in to a value of type `T`, using the
+// session's `Serializer`.
+//
+// This saves having to pick apart `Event.Data` for handlers that expect a
+// particular structure:
+//
+// 	type SumArgs struct {
+// 		Numbers []int `json:"numbers"`
+// 	}
+//
+// 	args, err := remit.Bind[SumArgs](event)
+//
+func Bind[T any](event Event) (T, error) {
+	var v T
+
+	if event.serializer == nil || len(event.Body) == 0 {
+		return v, ErrNoData
+	}
+
+	err := event.serializer.Unmarshal(event.Body, &v)
+
+	return v, err
+}
+
+// OnDataTyped registers data handlers for `endpoint` just like `Endpoint.OnData`,
+// but first decodes the data of each event in to a value of type `T` using `Bind`.
+//
+// If the data can't be decoded, the error is sent to `Event.Failure` and the
+// handlers are never run.
+//
+// 	remit.OnDataTyped(&endpoint, func(event remit.Event, args SumArgs) {
+// 		...
+// 	})
+//
+func OnDataTyped[T any](endpoint *Endpoint, handlers ...func(Event, T)) {
+	wrapped := make([]EndpointDataHandler, len(handlers))
+
+	for i, handler := range handlers {
+		handler := handler
+
+		wrapped[i] = func(event Event) {
+			v, err := Bind[T](event)
+			if err != nil {
+				event.Failure <- err.Error()
+				return
+			}
+
+			handler(event, v)
+		}
+	}
+
+	endpoint.OnData(wrapped...)
+}
+
+// Handle registers `handler` as a data handler for `endpoint`, decoding the
+// data of each event in to a `Req` using `Bind` and replying with whatever it
+// returns, so that neither `Event.Data` nor the event's channels need to be
+// touched at all:
+//
+// 	type SumArgs struct {
+// 		Numbers []int `json:"numbers"`
+// 	}
+//
+// 	remit.Handle(&endpoint, func(ctx context.Context, args SumArgs) (int, error) {
+// 		total := 0
+// 		for _, n := range args.Numbers {
+// 			total += n
+// 		}
+//
+// 		return total, nil
+// 	})
+//
+// An error returned by `handler` is sent to `Event.Failure`, so returning a
+// `RemitError` controls exactly what's replied. Events with no data are
+// handled with the zero value of `Req`, whilst data that can't be decoded is
+// replied to with a `RemitError` with the code `"invalid_request"` without
+// running `handler`.
+func Handle[Req any, Res any](endpoint *Endpoint, handler func(context.Context, Req) (Res, error)) {
+	endpoint.OnData(func(event Event) {
+		req, err := Bind[Req](event)
+		if err != nil && err != ErrNoData {
+			event.Failure <- RemitError{Code: "invalid_request", Message: err.Error()}
+			return
+		}
+
+		res, err := handler(event.Context(), req)
+		if err != nil {
+			event.Failure <- err
+			return
+		}
+
+		event.Success <- res
+	})
+}
@@ -1,55 +1,91 @@
 package remit
 
-import (
-	"sync"
-
-	"github.com/streadway/amqp"
-)
+import "sync"
 
 type workerPool struct {
 	mx         *sync.Mutex
 	min        int
 	max        int
-	channels   chan *amqp.Channel
+	channels   chan Channel
+	owned      map[Channel]bool
 	count      int
 	inuse      int
-	connection *amqp.Connection
+	connection Connection
 }
 
-func newWorkerPool(min int, max int, connection *amqp.Connection) *workerPool {
+func newWorkerPool(min int, max int) *workerPool {
 	p := &workerPool{
-		min:        min,
-		max:        max,
-		channels:   make(chan *amqp.Channel, max),
-		connection: connection,
-		mx:         &sync.Mutex{},
+		min:      min,
+		max:      max,
+		channels: make(chan Channel, max),
+		owned:    make(map[Channel]bool),
+		mx:       &sync.Mutex{},
+	}
+
+	return p
+}
+
+// reset discards all channels from any previous connection and fills the
+// pool with new ones from `connection`.
+//
+// Channels from the previous connection that are still in use are ignored
+// when they're released or dropped.
+func (p *workerPool) reset(connection Connection) error {
+	p.mx.Lock()
+
+	p.connection = connection
+	p.owned = make(map[Channel]bool)
+	p.count = 0
+	p.inuse = 0
+
+draining:
+	for {
+		select {
+		case <-p.channels:
+		default:
+			break draining
+		}
 	}
 
+	p.mx.Unlock()
+
 	for i := 0; i < p.min; i++ {
-		p.new()
+		err := p.new()
+		if err != nil {
+			return err
+		}
 	}
 
-	return p
+	return nil
 }
 
-func (p *workerPool) new() {
+func (p *workerPool) new() error {
 	p.mx.Lock()
 	defer p.mx.Unlock()
 
+	channel, err := p.create()
+	if err != nil {
+		return err
+	}
+
 	p.count++
-	channel := p.create()
 	p.channels <- channel
+
+	return nil
 }
 
-func (p *workerPool) create() *amqp.Channel {
+func (p *workerPool) create() (Channel, error) {
 	channel, err := p.connection.Channel()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return channel
+
+	p.owned[channel] = true
+
+	return channel, nil
 }
 
-func (p *workerPool) get() *amqp.Channel {
+func (p *workerPool) get() (Channel, error) {
 	// only defer an unlock on the first iteration here
 	looped := false
 
@@ -63,7 +99,10 @@ waiting:
 	if p.inuse < p.count {
 		p.inuse++
 	} else if p.count < p.max {
-		channel := p.create()
+		channel, err := p.create()
+		if err != nil {
+			return nil, err
+		}
 		p.channels <- channel
 		p.count++
 		p.inuse++
@@ -77,27 +116,38 @@ waiting:
 		go p.new()
 	}
 
-	return <-p.channels
+	return <-p.channels, nil
 }
 
-func (p *workerPool) release(channel *amqp.Channel) {
+func (p *workerPool) release(channel Channel) {
 	p.mx.Lock()
 	defer p.mx.Unlock()
 
+	if !p.owned[channel] {
+		// from a previous connection, so no longer any use
+		return
+	}
+
 	p.inuse--
 
 	if (p.count - p.inuse) > p.min {
 		channel.Close()
+		delete(p.owned, channel)
 		p.count--
 	} else {
 		p.channels <- channel
 	}
 }
 
-func (p *workerPool) drop(channel *amqp.Channel) {
+func (p *workerPool) drop(channel Channel) {
 	p.mx.Lock()
 	defer p.mx.Unlock()
 
+	if !p.owned[channel] {
+		return
+	}
+
+	delete(p.owned, channel)
 	p.count--
 	p.inuse--
 }